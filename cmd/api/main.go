@@ -14,6 +14,7 @@ import (
 	"os"
 	"rinha/config"
 	"rinha/internal/payments/handlers"
+	"rinha/internal/webhooks"
 )
 
 func main() {
@@ -46,10 +47,13 @@ func main() {
 	paymentHandler := handlers.NewPaymentHandler(redisClient)
 	summaryHandler := handlers.NewGetPaymentsSumaryHandler(dbpool)
 	purgeHandler := handlers.NewPurgePaymentsHandler(dbpool)
+	webhookHandler := handlers.NewWebhookHandler(webhooks.NewStore(dbpool))
 
 	e.POST("/payments", paymentHandler.Handle)
 	e.GET("/payments-summary", summaryHandler.Handle)
 	e.POST("/purge-payments", purgeHandler.Handle)
+	e.POST("/webhooks", echo.WrapHandler(webhookHandler))
+	e.DELETE("/webhooks/:id", echo.WrapHandler(webhookHandler))
 
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
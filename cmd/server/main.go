@@ -13,6 +13,7 @@ import (
 	"rinha/internal/payments"
 	"rinha/internal/payments/handlers"
 	"rinha/internal/payments/workers"
+	"rinha/internal/webhooks"
 	"time"
 )
 
@@ -44,21 +45,29 @@ func main() {
 
 	logger := setupLogger()
 
-	healthMonitor := workers.NewServiceMonitor(appConfig.Service.DefaultHealthURL, appConfig.Service.FallbackHealthURL, httpClient, logger)
+	dbpool := setupDbPool(appConfig)
+	defer dbpool.Close()
+
+	webhookStore := webhooks.NewStore(dbpool)
+	webhookDispatcher := webhooks.NewDispatcher(webhookStore, httpClient, logger)
+
+	routingWeights := workers.RoutingWeights{
+		LatencyWeight: appConfig.Service.RoutingLatencyWeight,
+		FailureWeight: appConfig.Service.RoutingFailureWeight,
+		Epsilon:       appConfig.Service.RoutingEpsilon,
+	}
+	healthMonitor := workers.NewServiceMonitor(appConfig.Service.DefaultHealthURL, appConfig.Service.FallbackHealthURL, httpClient, logger, webhookDispatcher, appConfig.Service.DefaultFee, appConfig.Service.FallbackFee, routingWeights)
 	go healthMonitor.StartMonitoring()
 	defer healthMonitor.Stop()
 
 	defaultProcessor := payments.NewPaymentProcessor(httpClient, appConfig.Service.DefaultURL, payments.ProcessorTypeDefault)
 	fallbackProcessor := payments.NewPaymentProcessor(httpClient, appConfig.Service.FallbackURL, payments.ProcessorTypeFallback)
 
-	dbpool := setupDbPool(appConfig)
-	defer dbpool.Close()
-
 	// Create the payment store
 	pStore := payments.NewPaymentStore(dbpool, logger)
 
 	// Create the worker pool with the store
-	workerPool := workers.NewWorkerPool(defaultProcessor, fallbackProcessor, pStore, healthMonitor, logger)
+	workerPool := workers.NewWorkerPool(defaultProcessor, fallbackProcessor, pStore, healthMonitor, logger, webhookDispatcher)
 	go workerPool.Start()
 	defer workerPool.Stop()
 
@@ -66,10 +75,13 @@ func main() {
 	paymentHandler := handlers.NewPaymentHandler(workerPool)
 	summaryHandler := handlers.NewSummaryHandler(pStore, httpClient)
 	purgeHandler := handlers.NewPurgeHandler(pStore)
+	webhookHandler := handlers.NewWebhookHandler(webhookStore)
 
 	mux.Handle("/payments", paymentHandler)
 	mux.Handle("/payments-summary", summaryHandler)
 	mux.Handle("/purge-payments", purgeHandler)
+	mux.Handle("/webhooks", webhookHandler)
+	mux.Handle("/webhooks/", webhookHandler)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -0,0 +1,79 @@
+// Command walrecover drains a DbBatcher WAL directory straight into
+// Postgres without starting the full worker consumer loop. It's meant for
+// operators recovering a WAL left behind by a crashed worker that isn't
+// coming back up on its own (e.g. the box is being decommissioned).
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"rinha/config"
+	"rinha/internal/payments/workers"
+)
+
+func main() {
+	appConfig, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !appConfig.Sink.WALEnabled {
+		log.Fatal("walrecover: sink.wal_enabled is false, nothing to recover")
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	dbConfig, err := pgxpool.ParseConfig(appConfig.Postgres.URL)
+	if err != nil {
+		log.Fatalf("walrecover: parse postgres url: %v", err)
+	}
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), dbConfig)
+	if err != nil {
+		log.Fatalf("walrecover: connect to postgres: %v", err)
+	}
+	defer dbpool.Close()
+
+	wal, err := workers.NewWAL(workers.WALConfig{
+		Dir:             appConfig.Sink.WALDir,
+		FsyncPolicy:     workers.FsyncPolicy(appConfig.Sink.WALFsyncPolicy),
+		FsyncInterval:   appConfig.Sink.WALFsyncInterval,
+		MaxSegmentBytes: appConfig.Sink.WALMaxSegmentBytes,
+	}, logger)
+	if err != nil {
+		log.Fatalf("walrecover: open wal: %v", err)
+	}
+	defer wal.Close()
+
+	pending := wal.Pending()
+	if len(pending) == 0 {
+		logger.Info("Nothing pending in the WAL")
+		return
+	}
+
+	recovered := 0
+	for _, entry := range pending {
+		_, err := dbpool.Exec(
+			context.Background(),
+			`INSERT INTO payments (amount, requested_at, service_used, correlation_id)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (correlation_id) DO NOTHING`,
+			entry.Payment.Amount,
+			entry.Payment.RequestedAt,
+			entry.Payment.Processor,
+			entry.Payment.CorrelationId,
+		)
+		if err != nil {
+			logger.Error("Failed to recover payment, leaving it in the WAL", "correlationId", entry.Payment.CorrelationId, "error", err)
+			continue
+		}
+		wal.Ack(entry.Seq)
+		recovered++
+	}
+
+	logger.Info("WAL recovery complete", "recovered", recovered, "total", len(pending))
+}
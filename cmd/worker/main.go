@@ -15,9 +15,15 @@ import (
 	"net/http"
 	"os"
 	"rinha/config"
+	"rinha/internal/metrics"
 	"rinha/internal/payments"
+	"rinha/internal/payments/handlers"
 	"rinha/internal/payments/workers"
+	"rinha/internal/payments/workers/streamconsumer"
+	"rinha/internal/webhooks"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -31,6 +37,10 @@ func main() {
 		defer cleanup()
 	}
 
+	if err := metrics.Init(appConfig.Telemetry.ServiceName); err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
 	dbpool := setupDbPool(appConfig)
 	defer dbpool.Close()
 
@@ -38,65 +48,171 @@ func main() {
 	httpClient := setupHttpClient(appConfig)
 	redisClient := setupRedisClient(appConfig)
 
-	defaultService := payments.NewPaymentService(httpClient, 0.05, appConfig.Service.DefaultURL, payments.ServiceTypeDefault, dbpool)
-	fallbackService := payments.NewPaymentService(httpClient, 0.15, appConfig.Service.FallbackURL, payments.ServiceTypeFallback, dbpool)
+	defaultService := payments.NewPaymentService(httpClient, appConfig.Service.DefaultFee, appConfig.Service.DefaultURL, payments.ServiceTypeDefault, dbpool)
+	fallbackService := payments.NewPaymentService(httpClient, appConfig.Service.FallbackFee, appConfig.Service.FallbackURL, payments.ServiceTypeFallback, dbpool)
 
+	webhookDispatcher := webhooks.NewDispatcher(webhooks.NewStore(dbpool), httpClient, logger)
+
+	routingWeights := workers.RoutingWeights{
+		LatencyWeight: appConfig.Service.RoutingLatencyWeight,
+		FailureWeight: appConfig.Service.RoutingFailureWeight,
+		Epsilon:       appConfig.Service.RoutingEpsilon,
+	}
 	serviceMonitor := workers.NewServiceMonitor(
 		appConfig.Service.DefaultURL,
 		appConfig.Service.FallbackURL,
 		httpClient,
 		logger,
+		webhookDispatcher,
+		appConfig.Service.DefaultFee,
+		appConfig.Service.FallbackFee,
+		routingWeights,
 	)
 
 	go serviceMonitor.StartMonitoring()
 
-	batcher := workers.NewDbBatcher(dbpool, logger)
+	sink, err := workers.NewSink(workers.SinkConfig{
+		Driver:            workers.SinkDriver(appConfig.Sink.Driver),
+		BatchSize:         appConfig.Sink.BatchSize,
+		BatchWindow:       appConfig.Sink.BatchWindow,
+		ClickHouseURL:     appConfig.Sink.ClickHouseURL,
+		ClickHouseTable:   appConfig.Sink.ClickHouseTable,
+		S3Bucket:          appConfig.Sink.S3Bucket,
+		S3Prefix:          appConfig.Sink.S3Prefix,
+		ParquetRotateRows: appConfig.Sink.ParquetRotateRows,
+		ParquetRotateTime: appConfig.Sink.ParquetRotateTime,
 
-	go batcher.Run()
+		WALEnabled:         appConfig.Sink.WALEnabled,
+		WALDir:             appConfig.Sink.WALDir,
+		WALFsyncPolicy:     appConfig.Sink.WALFsyncPolicy,
+		WALFsyncInterval:   appConfig.Sink.WALFsyncInterval,
+		WALMaxSegmentBytes: appConfig.Sink.WALMaxSegmentBytes,
+	}, dbpool, logger)
+	if err != nil {
+		logger.Error("Failed to build payment sink", "err", err)
+		os.Exit(1)
+	}
+	defer sink.Close()
+
+	worker := workers.NewPaymentWorker(defaultService, fallbackService, logger, serviceMonitor, sink, redisClient, appConfig.Service.RequestTimeout)
+
+	if err := metrics.RegisterGauges(
+		func() int64 { return int64(sink.BufferDepth()) },
+		worker.InFlight,
+	); err != nil {
+		logger.Error("Failed to register metric gauges", "err", err)
+	}
 
-	worker := workers.NewPaymentWorker(defaultService, fallbackService, logger, serviceMonitor, batcher, redisClient)
 	totalMessages := 0
 
+	consumerName := appConfig.Redis.ConsumerName
+	if consumerName == "" {
+		// Deriving the name from hostname+pid means scaling worker
+		// replicas doesn't require assigning each one a distinct
+		// consumer name through config.
+		consumerName = streamconsumer.Name()
+	}
+
+	processStreamMessages := func(ctx context.Context, msgs []redis.XMessage) {
+		reqs, ids, ok := decodePaymentMessages(msgs, logger)
+		if !ok {
+			return
+		}
+
+		totalMessages += len(reqs)
+		logger.Debug("Processing messages", "consumer", consumerName, "batchSize", len(reqs), "total", totalMessages)
+
+		failed := worker.Process(reqs)
+
+		// Acking only after Process returns means a crash mid-batch
+		// leaves these entries pending, so the reclaimer hands them to
+		// another consumer instead of them being silently lost. Entries
+		// whose persistence failed are excluded so the same reclaim path
+		// redelivers them instead of losing them to a blanket ack.
+		ackIds := ids
+		if len(failed) > 0 {
+			ackIds = ackIds[:0]
+			for i, req := range reqs {
+				if err, ok := failed[req.CorrelationId]; ok {
+					logger.Error("Withholding ack, payment failed to persist", "correlationId", req.CorrelationId, "error", err)
+					continue
+				}
+				ackIds = append(ackIds, ids[i])
+			}
+		}
+		if len(ackIds) > 0 {
+			redisClient.XAck(ctx, appConfig.Redis.StreamName, appConfig.Redis.StreamGroup, ackIds...)
+		}
+	}
+
+	reclaimer := streamconsumer.NewReclaimer(
+		redisClient,
+		appConfig.Redis.StreamName,
+		appConfig.Redis.StreamGroup,
+		consumerName,
+		appConfig.Redis.ReclaimMinIdle,
+		appConfig.Redis.ReclaimInterval,
+		logger,
+		processStreamMessages,
+	)
+	go reclaimer.Run(context.Background())
+
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/dlq", handlers.NewDLQHandler(redisClient))
+	adminMux.Handle("/dlq/replay", handlers.NewDLQHandler(redisClient))
+	adminMux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		addr := fmt.Sprintf(":%d", appConfig.Admin.Port)
+		if err := http.ListenAndServe(addr, adminMux); err != nil {
+			logger.Error("Admin HTTP listener stopped", "err", err)
+		}
+	}()
+
 	for {
 		streams, err := redisClient.XReadGroup(context.Background(), &redis.XReadGroupArgs{
 			Group:    appConfig.Redis.StreamGroup,
-			Consumer: appConfig.Redis.ConsumerName,
+			Consumer: consumerName,
 			Streams:  []string{appConfig.Redis.StreamName, ">"},
 			Block:    5 * time.Millisecond,
 			Count:    200,
 		}).Result()
 
 		if err != nil && !errors.Is(err, redis.Nil) {
-			logger.Error("[%s] error: %v", appConfig.Redis.ConsumerName, err)
+			logger.Error("[%s] error: %v", consumerName, err)
 			continue
 		}
 
 		for _, stream := range streams {
-			batchLen := len(stream.Messages)
-			if batchLen == 0 {
+			if len(stream.Messages) == 0 {
 				continue
 			}
+			processStreamMessages(context.Background(), stream.Messages)
+		}
+	}
+}
 
-			totalMessages += batchLen
-			reqs := make([]payments.PaymentMessage, batchLen)
-
-			for i, msg := range stream.Messages {
-				raw := msg.Values["data"].(string)
+// decodePaymentMessages turns a batch of raw stream entries into
+// PaymentMessages and their IDs (for the caller's XAck), shared by both
+// the main XReadGroup loop and the Reclaimer's claimed-entry handler so
+// a message recovered from a crashed consumer is processed identically
+// to one read fresh.
+func decodePaymentMessages(msgs []redis.XMessage, logger *slog.Logger) ([]payments.PaymentMessage, []string, bool) {
+	reqs := make([]payments.PaymentMessage, len(msgs))
+	ids := make([]string, len(msgs))
 
-				var payload payments.PaymentMessage
-				if err := json.Unmarshal([]byte(raw), &payload); err != nil {
-					logger.Error("Invalid JSON: %v", err)
-					return
-				}
-				reqs[i] = payload
-				redisClient.XAck(context.Background(), appConfig.Redis.StreamName, appConfig.Redis.StreamGroup, msg.ID)
-			}
+	for i, msg := range msgs {
+		raw := msg.Values["data"].(string)
 
-			logger.Debug("Processing messages", "consumer", appConfig.Redis.ConsumerName, "batchSize", len(stream.Messages), "total", totalMessages)
-
-			worker.Process(reqs)
+		var payload payments.PaymentMessage
+		if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+			logger.Error("Invalid JSON: %v", err)
+			return nil, nil, false
 		}
+		reqs[i] = payload
+		ids[i] = msg.ID
 	}
+
+	return reqs, ids, true
 }
 
 func setupLogger(appConfig *config.AppConfig) *slog.Logger {
@@ -112,14 +228,16 @@ func setupLogger(appConfig *config.AppConfig) *slog.Logger {
 }
 
 func setupHttpClient(appConfig *config.AppConfig) *http.Client {
-	transport := http.DefaultTransport
+	client := payments.NewProcessorHTTPClient(payments.HTTPClientConfig{
+		Timeout:             appConfig.Service.HTTPClientTimeout,
+		MaxIdleConnsPerHost: appConfig.Service.HTTPClientMaxIdleConnsPerHost,
+		IdleConnTimeout:     appConfig.Service.HTTPClientIdleConnTimeout,
+		DialTimeout:         appConfig.Service.HTTPClientDialTimeout,
+	})
 	if appConfig.Telemetry.Enabled {
-		transport = otelhttp.NewTransport(http.DefaultTransport)
-	}
-	return &http.Client{
-		Transport: transport,
-		Timeout:   500 * time.Millisecond,
+		client.Transport = otelhttp.NewTransport(client.Transport)
 	}
+	return client
 }
 
 func setupDbPool(appConfig *config.AppConfig) *pgxpool.Pool {
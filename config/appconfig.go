@@ -3,6 +3,7 @@ package config
 import (
 	"github.com/spf13/viper"
 	"log"
+	"time"
 )
 
 type ServerConfig struct {
@@ -19,6 +20,19 @@ type RedisConfig struct {
 	StreamName   string `mapstructure:"stream_name"`
 	StreamGroup  string `mapstructure:"stream_group"`
 	ConsumerName string `mapstructure:"consumer_name"`
+
+	// ReclaimMinIdle/ReclaimInterval tune streamconsumer.Reclaimer: an
+	// entry pending longer than ReclaimMinIdle is eligible to be stolen
+	// from its consumer, checked every ReclaimInterval.
+	ReclaimMinIdle  time.Duration `mapstructure:"reclaim_min_idle"`
+	ReclaimInterval time.Duration `mapstructure:"reclaim_interval"`
+}
+
+// AdminConfig configures the worker process's admin HTTP listener, used
+// for operational endpoints like DLQ replay that act directly against
+// Redis rather than going through the payments stream.
+type AdminConfig struct {
+	Port int `mapstructure:"port"`
 }
 
 type TelemetryConfig struct {
@@ -27,9 +41,53 @@ type TelemetryConfig struct {
 	JaegerURL   string `mapstructure:"jaeger_url"`
 }
 
+type SinkConfig struct {
+	Driver      string        `mapstructure:"driver"`
+	BatchSize   int           `mapstructure:"batch_size"`
+	BatchWindow time.Duration `mapstructure:"batch_window"`
+
+	ClickHouseURL   string `mapstructure:"clickhouse_url"`
+	ClickHouseTable string `mapstructure:"clickhouse_table"`
+
+	S3Bucket          string        `mapstructure:"s3_bucket"`
+	S3Prefix          string        `mapstructure:"s3_prefix"`
+	ParquetRotateRows int           `mapstructure:"parquet_rotate_rows"`
+	ParquetRotateTime time.Duration `mapstructure:"parquet_rotate_time"`
+
+	// WAL* tune DbBatcher's write-ahead log; see workers.WALConfig.
+	WALEnabled         bool          `mapstructure:"wal_enabled"`
+	WALDir             string        `mapstructure:"wal_dir"`
+	WALFsyncPolicy     string        `mapstructure:"wal_fsync_policy"`
+	WALFsyncInterval   time.Duration `mapstructure:"wal_fsync_interval"`
+	WALMaxSegmentBytes int64         `mapstructure:"wal_max_segment_bytes"`
+}
+
 type ServiceConfig struct {
 	DefaultURL  string `mapstructure:"default_url"`
 	FallbackURL string `mapstructure:"fallback_url"`
+
+	DefaultFee  float64 `mapstructure:"default_fee"`
+	FallbackFee float64 `mapstructure:"fallback_fee"`
+
+	// RoutingLatencyWeight/RoutingFailureWeight/RoutingEpsilon tune
+	// ProcessorHealthMonitor's cost-based DetermineProcessor; see
+	// workers.RoutingWeights.
+	RoutingLatencyWeight float64 `mapstructure:"routing_latency_weight"`
+	RoutingFailureWeight float64 `mapstructure:"routing_failure_weight"`
+	RoutingEpsilon       float64 `mapstructure:"routing_epsilon"`
+
+	// RequestTimeout bounds a single outbound call to a processor: it is
+	// the deadline PaymentWorker derives its call context from. It is
+	// separate from HTTPClientTimeout, the http.Client-level timeout that
+	// applies to each Do call (each RetryGet attempt gets its own); the
+	// shorter of the two ends a payment call first.
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+
+	// HTTPClient* tune payments.NewProcessorHTTPClient's transport.
+	HTTPClientTimeout             time.Duration `mapstructure:"http_client_timeout"`
+	HTTPClientMaxIdleConnsPerHost int           `mapstructure:"http_client_max_idle_conns_per_host"`
+	HTTPClientIdleConnTimeout     time.Duration `mapstructure:"http_client_idle_conn_timeout"`
+	HTTPClientDialTimeout         time.Duration `mapstructure:"http_client_dial_timeout"`
 }
 
 type AppConfig struct {
@@ -38,6 +96,8 @@ type AppConfig struct {
 	Redis     *RedisConfig     `mapstructure:"redis"`
 	Telemetry *TelemetryConfig `mapstructure:"telemetry"`
 	Service   *ServiceConfig   `mapstructure:"service"`
+	Sink      *SinkConfig      `mapstructure:"sink"`
+	Admin     *AdminConfig     `mapstructure:"admin"`
 }
 
 func LoadConfig() (*AppConfig, error) {
@@ -51,6 +111,30 @@ func LoadConfig() (*AppConfig, error) {
 	viper.SetDefault("telemetry.jaeger_url", "http://jaeger:14268/api/traces")
 	viper.SetDefault("service.default_url", "http://localhost:8001/payments")
 	viper.SetDefault("service.fallback_url", "http://localhost:8002/payments")
+	viper.SetDefault("service.default_fee", 0.05)
+	viper.SetDefault("service.fallback_fee", 0.15)
+	viper.SetDefault("service.routing_latency_weight", 0.001)
+	viper.SetDefault("service.routing_failure_weight", 0.5)
+	viper.SetDefault("service.routing_epsilon", 0.05)
+	viper.SetDefault("service.request_timeout", 800*time.Millisecond)
+	viper.SetDefault("service.http_client_timeout", 500*time.Millisecond)
+	viper.SetDefault("service.http_client_max_idle_conns_per_host", 64)
+	viper.SetDefault("service.http_client_idle_conn_timeout", 90*time.Second)
+	viper.SetDefault("service.http_client_dial_timeout", 2*time.Second)
+	viper.SetDefault("redis.reclaim_min_idle", 30*time.Second)
+	viper.SetDefault("redis.reclaim_interval", 10*time.Second)
+	viper.SetDefault("sink.driver", "postgres")
+	viper.SetDefault("sink.batch_size", 100)
+	viper.SetDefault("sink.batch_window", 2*time.Millisecond)
+	viper.SetDefault("sink.clickhouse_table", "payments")
+	viper.SetDefault("sink.parquet_rotate_rows", 50000)
+	viper.SetDefault("sink.parquet_rotate_time", 5*time.Minute)
+	viper.SetDefault("sink.wal_enabled", false)
+	viper.SetDefault("sink.wal_dir", "data/wal")
+	viper.SetDefault("sink.wal_fsync_policy", "interval")
+	viper.SetDefault("sink.wal_fsync_interval", 200*time.Millisecond)
+	viper.SetDefault("sink.wal_max_segment_bytes", 64*1024*1024)
+	viper.SetDefault("admin.port", 9999)
 
 	_ = viper.BindEnv("server.port", "SERVER_PORT")
 	_ = viper.BindEnv("server.host", "SERVER_HOST")
@@ -61,9 +145,36 @@ func LoadConfig() (*AppConfig, error) {
 	_ = viper.BindEnv("telemetry.jaeger_url", "JAEGER_URL")
 	_ = viper.BindEnv("service.default_url", "SERVICE_DEFAULT_URL")
 	_ = viper.BindEnv("service.fallback_url", "SERVICE_FALLBACK_URL")
+	_ = viper.BindEnv("service.default_fee", "SERVICE_DEFAULT_FEE")
+	_ = viper.BindEnv("service.fallback_fee", "SERVICE_FALLBACK_FEE")
+	_ = viper.BindEnv("service.routing_latency_weight", "SERVICE_ROUTING_LATENCY_WEIGHT")
+	_ = viper.BindEnv("service.routing_failure_weight", "SERVICE_ROUTING_FAILURE_WEIGHT")
+	_ = viper.BindEnv("service.routing_epsilon", "SERVICE_ROUTING_EPSILON")
+	_ = viper.BindEnv("service.request_timeout", "SERVICE_REQUEST_TIMEOUT")
+	_ = viper.BindEnv("service.http_client_timeout", "SERVICE_HTTP_CLIENT_TIMEOUT")
+	_ = viper.BindEnv("service.http_client_max_idle_conns_per_host", "SERVICE_HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST")
+	_ = viper.BindEnv("service.http_client_idle_conn_timeout", "SERVICE_HTTP_CLIENT_IDLE_CONN_TIMEOUT")
+	_ = viper.BindEnv("service.http_client_dial_timeout", "SERVICE_HTTP_CLIENT_DIAL_TIMEOUT")
 	_ = viper.BindEnv("redis.stream_name", "REDIS_STREAM_NAME")
 	_ = viper.BindEnv("redis.stream_group", "REDIS_STREAM_GROUP")
 	_ = viper.BindEnv("redis.consumer_name", "REDIS_CONSUMER_NAME")
+	_ = viper.BindEnv("redis.reclaim_min_idle", "REDIS_RECLAIM_MIN_IDLE")
+	_ = viper.BindEnv("redis.reclaim_interval", "REDIS_RECLAIM_INTERVAL")
+	_ = viper.BindEnv("sink.driver", "SINK_DRIVER")
+	_ = viper.BindEnv("sink.batch_size", "SINK_BATCH_SIZE")
+	_ = viper.BindEnv("sink.batch_window", "SINK_BATCH_WINDOW")
+	_ = viper.BindEnv("sink.clickhouse_url", "SINK_CLICKHOUSE_URL")
+	_ = viper.BindEnv("sink.clickhouse_table", "SINK_CLICKHOUSE_TABLE")
+	_ = viper.BindEnv("sink.s3_bucket", "SINK_S3_BUCKET")
+	_ = viper.BindEnv("sink.s3_prefix", "SINK_S3_PREFIX")
+	_ = viper.BindEnv("sink.parquet_rotate_rows", "SINK_PARQUET_ROTATE_ROWS")
+	_ = viper.BindEnv("sink.parquet_rotate_time", "SINK_PARQUET_ROTATE_TIME")
+	_ = viper.BindEnv("sink.wal_enabled", "SINK_WAL_ENABLED")
+	_ = viper.BindEnv("sink.wal_dir", "SINK_WAL_DIR")
+	_ = viper.BindEnv("sink.wal_fsync_policy", "SINK_WAL_FSYNC_POLICY")
+	_ = viper.BindEnv("sink.wal_fsync_interval", "SINK_WAL_FSYNC_INTERVAL")
+	_ = viper.BindEnv("sink.wal_max_segment_bytes", "SINK_WAL_MAX_SEGMENT_BYTES")
+	_ = viper.BindEnv("admin.port", "ADMIN_PORT")
 
 	//viper.SetConfigFile("config/config.yaml")
 	//if err := viper.ReadInConfig(); err != nil {
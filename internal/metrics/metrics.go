@@ -0,0 +1,115 @@
+// Package metrics wires an OTel MeterProvider backed by a Prometheus pull
+// exporter, so the worker's existing OTel tracing gets a metrics
+// counterpart that can be scraped from /metrics instead of only living in
+// in-struct counters nothing ever read.
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Meter is the process-wide instrument factory, valid once Init returns
+// without error.
+var Meter metric.Meter
+
+var (
+	ProcessorRequestDuration       metric.Float64Histogram
+	DbBatcherFlushDuration         metric.Float64Histogram
+	DbBatcherBatchSize             metric.Int64Histogram
+	RetriesTotal                   metric.Int64Counter
+	DLQPushesTotal                 metric.Int64Counter
+	CircuitBreakerTransitionsTotal metric.Int64Counter
+)
+
+// Init creates the Prometheus exporter, installs the resulting
+// MeterProvider as the global one, and creates every instrument this
+// package exposes. It must run once, before workers and sinks start
+// handling payments: they read these instruments at call time and skip
+// recording while an instrument is still nil.
+func Init(serviceName string) error {
+	exporter, err := prometheus.New()
+	if err != nil {
+		return err
+	}
+
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(exporter))
+	otel.SetMeterProvider(provider)
+	Meter = provider.Meter(serviceName)
+
+	if ProcessorRequestDuration, err = Meter.Float64Histogram(
+		"payment_processor_request_duration_seconds",
+		metric.WithDescription("Latency of outbound payment processor HTTP calls, by service and outcome."),
+		metric.WithUnit("s"),
+	); err != nil {
+		return err
+	}
+
+	if DbBatcherFlushDuration, err = Meter.Float64Histogram(
+		"db_batcher_flush_duration_seconds",
+		metric.WithDescription("Latency of a DbBatcher.flush call."),
+		metric.WithUnit("s"),
+	); err != nil {
+		return err
+	}
+
+	if DbBatcherBatchSize, err = Meter.Int64Histogram(
+		"db_batcher_batch_size",
+		metric.WithDescription("Number of payments written by a single DbBatcher.flush call."),
+	); err != nil {
+		return err
+	}
+
+	if RetriesTotal, err = Meter.Int64Counter(
+		"payment_retries_total",
+		metric.WithDescription("Payments requeued for retry after a processor call failed."),
+	); err != nil {
+		return err
+	}
+
+	if DLQPushesTotal, err = Meter.Int64Counter(
+		"payment_dlq_pushes_total",
+		metric.WithDescription("Payments moved to the dead-letter stream after exhausting retries."),
+	); err != nil {
+		return err
+	}
+
+	if CircuitBreakerTransitionsTotal, err = Meter.Int64Counter(
+		"circuit_breaker_transitions_total",
+		metric.WithDescription("Circuit breaker state transitions, by processor and resulting state."),
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RegisterGauges installs observable gauges polled on every Prometheus
+// scrape: the sink's buffer depth and the adaptive limiter's in-flight
+// call count. It must run after Init.
+func RegisterGauges(bufferDepth func() int64, inFlight func() int64) error {
+	if _, err := Meter.Int64ObservableGauge(
+		"payment_sink_buffer_depth",
+		metric.WithDescription("Payments currently buffered in the sink awaiting the next flush."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(bufferDepth())
+			return nil
+		}),
+	); err != nil {
+		return err
+	}
+
+	_, err := Meter.Int64ObservableGauge(
+		"payment_processor_inflight",
+		metric.WithDescription("Outbound payment processor calls currently in flight."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(inFlight())
+			return nil
+		}),
+	)
+	return err
+}
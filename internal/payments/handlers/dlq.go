@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	dlqStreamName       = "payments:dlq"
+	paymentsStreamName  = "payments"
+	defaultDlqListLimit = 100
+)
+
+// DLQHandler inspects and replays the payments:dlq Redis stream that
+// PaymentWorker writes to once a message exceeds its retry budget.
+type DLQHandler struct {
+	redisClient *redis.Client
+}
+
+func NewDLQHandler(redisClient *redis.Client) *DLQHandler {
+	return &DLQHandler{redisClient: redisClient}
+}
+
+type dlqEntry struct {
+	ID        string `json:"id"`
+	Data      string `json:"data"`
+	Reason    string `json:"reason"`
+	LastError string `json:"lastError"`
+}
+
+// ServeHTTP handles GET /dlq?limit=N to inspect dead-lettered payments,
+// and POST /dlq/replay?limit=N to requeue up to limit of them back onto
+// the payments stream.
+func (h *DLQHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDlqListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r, limit)
+	case http.MethodPost:
+		h.replay(w, r, limit)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *DLQHandler) list(w http.ResponseWriter, r *http.Request, limit int) {
+	entries, err := h.readEntries(r, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func (h *DLQHandler) replay(w http.ResponseWriter, r *http.Request, limit int) {
+	entries, err := h.readEntries(r, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	requeued := 0
+	for _, entry := range entries {
+		_, err := h.redisClient.XAdd(r.Context(), &redis.XAddArgs{
+			Stream: paymentsStreamName,
+			Values: map[string]interface{}{"data": entry.Data},
+		}).Result()
+		if err != nil {
+			continue
+		}
+
+		if err := h.redisClient.XDel(r.Context(), dlqStreamName, entry.ID).Err(); err != nil {
+			continue
+		}
+		requeued++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"requeued": requeued})
+}
+
+func (h *DLQHandler) readEntries(r *http.Request, limit int) ([]dlqEntry, error) {
+	msgs, err := h.redisClient.XRangeN(r.Context(), dlqStreamName, "-", "+", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]dlqEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		entry := dlqEntry{ID: msg.ID}
+		if v, ok := msg.Values["data"].(string); ok {
+			entry.Data = v
+		}
+		if v, ok := msg.Values["reason"].(string); ok {
+			entry.Reason = v
+		}
+		if v, ok := msg.Values["lastError"].(string); ok {
+			entry.LastError = v
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
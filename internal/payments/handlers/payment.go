@@ -38,7 +38,7 @@ func (h *PaymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		RequestedAt:   time.Now().UTC(),
 	}
 
-	ok := h.workerPool.Submit(&msg)
+	ok := h.workerPool.SubmitContext(r.Context(), &msg)
 	if !ok {
 		w.WriteHeader(http.StatusTooManyRequests) // 429
 		return
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"rinha/internal/webhooks"
+)
+
+type WebhookHandler struct {
+	store *webhooks.Store
+}
+
+func NewWebhookHandler(store *webhooks.Store) *WebhookHandler {
+	return &WebhookHandler{store: store}
+}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	Secret     string   `json:"secret"`
+}
+
+// ServeHTTP handles POST /webhooks (create) and DELETE /webhooks/{id}.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.create(w, r)
+	case http.MethodDelete:
+		h.delete(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WebhookHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.URL == "" || len(req.EventTypes) == 0 || req.Secret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	eventTypes := make([]webhooks.EventType, len(req.EventTypes))
+	for i, t := range req.EventTypes {
+		eventTypes[i] = webhooks.EventType(t)
+	}
+
+	sub, err := h.store.Create(r.Context(), req.URL, eventTypes, req.Secret)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sub)
+}
+
+func (h *WebhookHandler) delete(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/webhooks/")
+	if id == "" || id == r.URL.Path {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
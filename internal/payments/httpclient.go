@@ -0,0 +1,96 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPClientConfig tunes the transport NewProcessorHTTPClient builds for
+// outbound calls to the default/fallback processors.
+type HTTPClientConfig struct {
+	Timeout             time.Duration
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+}
+
+// NewProcessorHTTPClient builds an *http.Client tuned for high-fan-out
+// calls to a small, fixed set of processor hosts: idle connections are
+// kept warm per host well past net/http's default of 2, and HTTP/2 is
+// attempted so a processor that supports it can multiplex calls over one
+// connection instead of PaymentWorker's concurrency opening a new one per
+// in-flight request.
+func NewProcessorHTTPClient(cfg HTTPClientConfig) *http.Client {
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = 64
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = 90 * time.Second
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 2 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 500 * time.Millisecond
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConnsPerHost * 4,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   2 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+	}
+}
+
+// RetryGet issues an idempotent GET, making up to maxAttempts attempts in
+// all, with jittered backoff between them, on a transport error or 5xx. It must only be used for
+// GETs: PaymentService's own processor call is a POST and never goes
+// through this path, since retrying it risks double-charging.
+func RetryGet(ctx context.Context, client *http.Client, url string, maxAttempts int) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(attempt) * 50 * time.Millisecond
+			jitter := time.Duration(rand.Int63n(int64(backoff) + 1))
+			select {
+			case <-time.After(backoff + jitter):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			_ = resp.Body.Close()
+			lastErr = fmt.Errorf("payments: GET %s: status %d", url, resp.StatusCode)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
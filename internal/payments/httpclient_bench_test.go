@@ -0,0 +1,39 @@
+package payments
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// BenchmarkProcessorHTTPClient_Get and BenchmarkDefaultHTTPClient_Get
+// compare RetryGet's throughput over NewProcessorHTTPClient's per-host
+// connection pool and forced HTTP/2 attempt against a bare http.Client
+// (the setup cmd/worker used before this request), under the kind of
+// concurrent load a processor's health endpoint sees at peak.
+func BenchmarkProcessorHTTPClient_Get(b *testing.B) {
+	benchmarkGet(b, NewProcessorHTTPClient(HTTPClientConfig{}))
+}
+
+func BenchmarkDefaultHTTPClient_Get(b *testing.B) {
+	benchmarkGet(b, &http.Client{})
+}
+
+func benchmarkGet(b *testing.B, client *http.Client) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := RetryGet(context.Background(), client, srv.URL, 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+	})
+}
@@ -10,8 +10,11 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	"net/http"
+	"rinha/internal/metrics"
+	"time"
 )
 
 type ServiceType string
@@ -47,7 +50,7 @@ func (s *PaymentService) Process(ctx context.Context, msg PaymentMessage) error
 	return s.callPaymentService(ctx, msg)
 }
 
-func (s *PaymentService) callPaymentService(ctx context.Context, payload PaymentMessage) error {
+func (s *PaymentService) callPaymentService(ctx context.Context, payload PaymentMessage) (err error) {
 	// Create a span for the HTTP call
 	tracer := otel.Tracer("payment-service")
 	ctx, span := tracer.Start(ctx, "call-payment-service", trace.WithAttributes(
@@ -58,6 +61,21 @@ func (s *PaymentService) callPaymentService(ctx context.Context, payload Payment
 	))
 	defer span.End()
 
+	start := time.Now()
+	defer func() {
+		if metrics.ProcessorRequestDuration == nil {
+			return
+		}
+		outcome := "success"
+		if err != nil {
+			outcome = "failure"
+		}
+		metrics.ProcessorRequestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("service", string(s.serviceType)),
+			attribute.String("outcome", outcome),
+		))
+	}()
+
 	bodyJSON, err := json.Marshal(payload)
 	if err != nil {
 		span.RecordError(err)
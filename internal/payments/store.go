@@ -91,6 +91,67 @@ func (ps *PaymentStore) Purge(ctx context.Context) error {
 	return err
 }
 
+// DeadLetter is a payment that exhausted its retries (or was dropped
+// because the retry queue was full), persisted to payments_dead_letter
+// so it can be inspected or requeued later instead of being lost.
+type DeadLetter struct {
+	ID            int64
+	CorrelationId string
+	Amount        float64
+	RequestedAt   time.Time
+	RetryCount    int
+	LastError     string
+	NextAttempt   time.Time
+}
+
+func (ps *PaymentStore) AddDeadLetter(ctx context.Context, dl DeadLetter) error {
+	_, err := ps.dbpool.Exec(ctx,
+		`INSERT INTO payments_dead_letter (correlation_id, amount, requested_at, retry_count, last_error, next_attempt)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		dl.CorrelationId, dl.Amount, dl.RequestedAt, dl.RetryCount, dl.LastError, dl.NextAttempt,
+	)
+	return err
+}
+
+// DueDeadLetters returns up to limit dead letters whose next_attempt has
+// already passed, oldest first, for WorkerPool.Start to resubmit to its
+// queue on startup.
+func (ps *PaymentStore) DueDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	return ps.queryDeadLetters(ctx, "WHERE next_attempt <= now()", limit)
+}
+
+// ListDeadLetters returns up to limit dead letters regardless of
+// next_attempt, oldest first, for the admin replay endpoint.
+func (ps *PaymentStore) ListDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	return ps.queryDeadLetters(ctx, "", limit)
+}
+
+func (ps *PaymentStore) queryDeadLetters(ctx context.Context, where string, limit int) ([]DeadLetter, error) {
+	query := "SELECT id, correlation_id, amount, requested_at, retry_count, last_error, next_attempt FROM payments_dead_letter " +
+		where + " ORDER BY next_attempt LIMIT $1"
+
+	rows, err := ps.dbpool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DeadLetter
+	for rows.Next() {
+		var dl DeadLetter
+		if err := rows.Scan(&dl.ID, &dl.CorrelationId, &dl.Amount, &dl.RequestedAt, &dl.RetryCount, &dl.LastError, &dl.NextAttempt); err != nil {
+			return nil, err
+		}
+		items = append(items, dl)
+	}
+	return items, rows.Err()
+}
+
+func (ps *PaymentStore) DeleteDeadLetter(ctx context.Context, id int64) error {
+	_, err := ps.dbpool.Exec(ctx, "DELETE FROM payments_dead_letter WHERE id = $1", id)
+	return err
+}
+
 func (ps *PaymentStore) Close() { close(ps.done) }
 
 func (ps *PaymentStore) consume() {
@@ -146,7 +207,9 @@ func (ps *PaymentStore) flush(batch []Payment) {
 		if len(batchCopy) == 1 {
 			_, err := ps.dbpool.Exec(
 				ctx,
-				"INSERT INTO payments (amount, requested_at, service_used, correlation_id) VALUES ($1, $2, $3, $4)",
+				`INSERT INTO payments (amount, requested_at, service_used, correlation_id)
+				 VALUES ($1, $2, $3, $4)
+				 ON CONFLICT (correlation_id) DO NOTHING`,
 				batchCopy[0].Amount,
 				batchCopy[0].RequestedAt,
 				batchCopy[0].Processor,
@@ -158,18 +221,47 @@ func (ps *PaymentStore) flush(batch []Payment) {
 			return
 		}
 
-		_, err := ps.dbpool.CopyFrom(
-			ctx,
-			pgx.Identifier{"payments"},
-			[]string{"amount", "requested_at", "service_used", "correlation_id"},
-			pgx.CopyFromSlice(len(batchCopy), func(i int) ([]any, error) {
-				return []any{batchCopy[i].Amount, batchCopy[i].RequestedAt, batchCopy[i].Processor, batchCopy[i].CorrelationId}, nil
-			}),
-		)
-		if err != nil {
+		if err := CopyInsertPayments(ctx, ps.dbpool, batchCopy); err != nil {
 			log.Println("failed to insert payment into database", "error", err)
-		} else {
 		}
-
 	}(batch)
 }
+
+// CopyInsertPayments stages batch into a session-local temp table via
+// CopyFrom and merges it into payments with a single INSERT ... SELECT,
+// since CopyFrom can't express ON CONFLICT directly. It's shared by
+// PaymentStore and workers.DbBatcher, the two writers that both flush
+// batched Payments into the same table, so the staging-table workaround
+// only needs to be maintained in one place.
+func CopyInsertPayments(ctx context.Context, dbpool *pgxpool.Pool, batch []Payment) error {
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `CREATE TEMP TABLE payments_staging
+		(amount double precision, requested_at timestamp, service_used text, correlation_id text)
+		ON COMMIT DROP`); err != nil {
+		return err
+	}
+
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"payments_staging"},
+		[]string{"amount", "requested_at", "service_used", "correlation_id"},
+		pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+			return []any{batch[i].Amount, batch[i].RequestedAt, batch[i].Processor, batch[i].CorrelationId}, nil
+		}),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO payments (amount, requested_at, service_used, correlation_id)
+		SELECT amount, requested_at, service_used, correlation_id FROM payments_staging
+		ON CONFLICT (correlation_id) DO NOTHING`); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
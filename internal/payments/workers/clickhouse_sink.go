@@ -0,0 +1,83 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"rinha/internal/payments"
+)
+
+// ClickHouseSink is a PaymentSink that writes settled payments into a
+// ClickHouse table, so the /payments-summary reporting path can run
+// analytical queries without touching the OLTP Postgres database.
+type ClickHouseSink struct {
+	conn   driver.Conn
+	table  string
+	logger *slog.Logger
+	buf    *batchBuffer
+}
+
+func NewClickHouseSink(cfg SinkConfig, logger *slog.Logger) (*ClickHouseSink, error) {
+	conn, err := clickhouse.Open(&clickhouse.Options{
+		Addr: []string{cfg.ClickHouseURL},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	table := cfg.ClickHouseTable
+	if table == "" {
+		table = "payments"
+	}
+
+	ch := &ClickHouseSink{
+		conn:   conn,
+		table:  table,
+		logger: logger,
+	}
+	ch.buf = newBatchBuffer(cfg.BatchSize, cfg.BatchWindow, ch.flush, logger)
+	return ch, nil
+}
+
+func (ch *ClickHouseSink) Push(payment payments.Payment, onDone func(error)) {
+	ch.buf.push(payment, onDone)
+}
+
+func (ch *ClickHouseSink) Flush(ctx context.Context) error {
+	return ch.buf.flushNow(ctx)
+}
+
+func (ch *ClickHouseSink) Close() error {
+	return ch.conn.Close()
+}
+
+func (ch *ClickHouseSink) BufferDepth() int {
+	return ch.buf.depth()
+}
+
+// flush writes batch as one prepared batch insert (PrepareBatch/Send) and
+// returns once the server has accepted the block. ClickHouse's
+// async_insert mode is not enabled on this insert.
+func (ch *ClickHouseSink) flush(ctx context.Context, batch []payments.Payment) error {
+	chBatch, err := ch.conn.PrepareBatch(ctx, "INSERT INTO "+ch.table+" (amount, requested_at, service_used, correlation_id)")
+	if err != nil {
+		ch.logger.Error("failed to prepare clickhouse batch", "error", err)
+		return err
+	}
+
+	for _, p := range batch {
+		if err := chBatch.Append(p.Amount, p.RequestedAt, string(p.Processor), p.CorrelationId); err != nil {
+			ch.logger.Error("failed to append payment to clickhouse batch", "error", err)
+			return err
+		}
+	}
+
+	if err := chBatch.Send(); err != nil {
+		ch.logger.Error("failed to send clickhouse batch", "error", err, "batchSize", len(batch))
+		return err
+	}
+	return nil
+}
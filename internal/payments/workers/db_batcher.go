@@ -2,129 +2,159 @@ package workers
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5"
+	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"log/slog"
+	"rinha/internal/metrics"
 	"rinha/internal/payments"
 	"time"
 )
 
-const (
-	maxBatchSize   = 100
-	maxBatchWindow = 2 * time.Millisecond
-)
-
+// DbBatcher is the default PaymentSink: it batches settled payments and
+// writes them straight into the OLTP Postgres database via CopyFrom. When
+// cfg enables a WAL, every Push is durably staged to disk first, so a
+// crash between a processor call succeeding and the flush committing
+// doesn't lose the payment.
 type DbBatcher struct {
-	dbpool   *pgxpool.Pool
-	bufferCh chan payments.Payment
-	logger   *slog.Logger
+	dbpool *pgxpool.Pool
+	logger *slog.Logger
+	buf    *batchBuffer
+	wal    *WAL
 }
 
-func NewDbBatcher(dbpool *pgxpool.Pool, logger *slog.Logger) *DbBatcher {
-	return &DbBatcher{
-		dbpool:   dbpool,
-		bufferCh: make(chan payments.Payment, 10*maxBatchSize),
-		logger:   logger,
+func NewDbBatcher(cfg SinkConfig, dbpool *pgxpool.Pool, logger *slog.Logger) (*DbBatcher, error) {
+	db := &DbBatcher{
+		dbpool: dbpool,
+		logger: logger,
 	}
-}
+	db.buf = newBatchBuffer(cfg.BatchSize, cfg.BatchWindow, db.flush, logger)
+
+	if cfg.WALEnabled {
+		wal, err := NewWAL(WALConfig{
+			Dir:             cfg.WALDir,
+			FsyncPolicy:     FsyncPolicy(cfg.WALFsyncPolicy),
+			FsyncInterval:   cfg.WALFsyncInterval,
+			MaxSegmentBytes: cfg.WALMaxSegmentBytes,
+		}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("workers: db batcher: %w", err)
+		}
+		db.wal = wal
 
-func (db *DbBatcher) PushPayment(payment payments.Payment) {
-	select {
-	case db.bufferCh <- payment:
-	default:
-		db.logger.Error("Buffer channel is full, dropping payment")
+		for _, entry := range wal.Pending() {
+			seq := entry.Seq
+			db.buf.push(entry.Payment, func(err error) {
+				if err == nil {
+					db.wal.Ack(seq)
+				}
+			})
+		}
 	}
+
+	return db, nil
 }
 
-func (db *DbBatcher) Run() {
-	var (
-		batch      []payments.Payment
-		timer      *time.Timer
-		timerCh    <-chan time.Time
-		addToBatch = func(payment payments.Payment) {
-			batch = append(batch, payment)
-			if len(batch) == 1 {
-				if timer == nil {
-					timer = time.NewTimer(maxBatchWindow)
-				} else {
-					timer.Reset(maxBatchWindow)
-				}
-				timerCh = timer.C
-			}
-			if len(batch) >= maxBatchSize {
-				db.flush(batch)
-				batch = nil
-				if timer != nil {
-					timer.Stop()
-				}
-				timerCh = nil
-			}
+// Push stages payment in the WAL (if enabled) before buffering it, and
+// only acks the WAL entry once flush confirms the write succeeded, so a
+// crash mid-batch leaves it in the WAL for the next startup to replay.
+func (db *DbBatcher) Push(payment payments.Payment, onDone func(error)) {
+	if db.wal == nil {
+		db.buf.push(payment, onDone)
+		return
+	}
+
+	seq, err := db.wal.Append(payment)
+	if err != nil {
+		db.logger.Error("failed to append payment to WAL", "error", err, "correlationId", payment.CorrelationId)
+		if onDone != nil {
+			onDone(err)
 		}
-	)
+		return
+	}
 
-	for {
-		select {
-		case payment := <-db.bufferCh:
-			addToBatch(payment)
-		case <-timerCh:
-			if len(batch) > 0 {
-				db.logger.Debug("Flushing batch", "batchSize", len(batch))
-				db.flush(batch)
-				batch = nil
-			}
-			timerCh = nil
+	db.buf.push(payment, func(err error) {
+		if err == nil {
+			db.wal.Ack(seq)
 		}
+		if onDone != nil {
+			onDone(err)
+		}
+	})
+}
+
+func (db *DbBatcher) Flush(ctx context.Context) error {
+	return db.buf.flushNow(ctx)
+}
+
+func (db *DbBatcher) Close() error {
+	if db.wal != nil {
+		return db.wal.Close()
 	}
+	return nil
+}
+
+func (db *DbBatcher) BufferDepth() int {
+	return db.buf.depth()
 }
 
 var tracer = otel.Tracer("db-batcher")
 
-func (db *DbBatcher) flush(batch []payments.Payment) {
-	go func(batchCopy []payments.Payment) {
-		ctx, span := tracer.Start(
-			context.Background(),
-			"db_batcher.flush",
-			trace.WithAttributes(
-				attribute.Int("batch.size", len(batchCopy)),
-			),
-		)
-		defer span.End()
-
-		if len(batchCopy) == 1 {
-			_, err := db.dbpool.Exec(
-				ctx,
-				"INSERT INTO payments (amount, requested_at, service_used, correlation_id) VALUES ($1, $2, $3, $4)",
-				batchCopy[0].Amount,
-				batchCopy[0].RequestedAt,
-				batchCopy[0].ServiceUsed,
-				batchCopy[0].CorrelationId,
-			)
-			if err != nil {
-				db.logger.Error("failed to insert payment into database", "error", err)
-			}
-			return
+func (db *DbBatcher) flush(ctx context.Context, batch []payments.Payment) error {
+	ctx, span := tracer.Start(
+		ctx,
+		"db_batcher.flush",
+		trace.WithAttributes(
+			attribute.Int("batch.size", len(batch)),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		if metrics.DbBatcherFlushDuration != nil {
+			metrics.DbBatcherFlushDuration.Record(ctx, time.Since(start).Seconds())
+		}
+		if metrics.DbBatcherBatchSize != nil {
+			metrics.DbBatcherBatchSize.Record(ctx, int64(len(batch)))
 		}
+	}()
 
-		_, err := db.dbpool.CopyFrom(
+	if len(batch) == 1 {
+		_, err := db.dbpool.Exec(
 			ctx,
-			pgx.Identifier{"payments"},
-			[]string{"amount", "requested_at", "service_used", "correlation_id"},
-			pgx.CopyFromSlice(len(batchCopy), func(i int) ([]any, error) {
-				return []any{batchCopy[i].Amount, batchCopy[i].RequestedAt, batchCopy[i].ServiceUsed, batchCopy[i].CorrelationId}, nil
-			}),
+			`INSERT INTO payments (amount, requested_at, service_used, correlation_id)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (correlation_id) DO NOTHING`,
+			batch[0].Amount,
+			batch[0].RequestedAt,
+			batch[0].Processor,
+			batch[0].CorrelationId,
 		)
 		if err != nil {
 			db.logger.Error("failed to insert payment into database", "error", err)
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
-		} else {
-			span.SetStatus(codes.Ok, "")
-			span.SetAttributes(attribute.Int("rows.inserted", len(batchCopy)))
 		}
+		return err
+	}
+
+	// CopyFrom can't express ON CONFLICT, so payments.CopyInsertPayments
+	// stages the batch into a temp table and merges it with a single
+	// INSERT ... SELECT, which also makes a redelivered batch idempotent.
+	// PaymentStore flushes into the same table the same way, so the
+	// staging-table workaround is shared rather than duplicated here.
+	if err := payments.CopyInsertPayments(ctx, db.dbpool, batch); err != nil {
+		db.logger.Error("failed to insert payment into database", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
 
-	}(batch)
+	span.SetStatus(codes.Ok, "")
+	span.SetAttributes(attribute.Int("rows.inserted", len(batch)))
+	return nil
 }
@@ -0,0 +1,50 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrDuplicatePayment classifies a message whose CorrelationId has already
+// been claimed within dedupTTL, so PaymentWorker can skip it without
+// counting it as a processing failure.
+var ErrDuplicatePayment = errors.New("duplicate payment")
+
+// dedupTTL only needs to cover the window a redelivery or client retry is
+// plausible in; 10 minutes comfortably outlives the retry backoff in
+// retryFailedPayment.
+const dedupTTL = 10 * time.Minute
+
+// Deduper guards against a CorrelationId reaching a processor twice, which
+// happens when the API retries a submission or the Redis stream redelivers
+// a message that was actually processed before a crash. It's a fast SETNX
+// check, not the source of truth: the unique index on
+// payments(correlation_id) is what ultimately keeps a duplicate row out of
+// the sink, this just saves the extra outbound processor call.
+type Deduper struct {
+	redisClient *redis.Client
+}
+
+func NewDeduper(redisClient *redis.Client) *Deduper {
+	return &Deduper{redisClient: redisClient}
+}
+
+// Claim returns nil the first time correlationId is seen, and
+// ErrDuplicatePayment on every subsequent call within dedupTTL.
+func (d *Deduper) Claim(ctx context.Context, correlationId string) error {
+	claimed, err := d.redisClient.SetNX(ctx, dedupKey(correlationId), 1, dedupTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrDuplicatePayment
+	}
+	return nil
+}
+
+func dedupKey(correlationId string) string {
+	return "payments:dedup:" + correlationId
+}
@@ -0,0 +1,163 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"rinha/internal/payments"
+)
+
+// parquetRow mirrors payments.Payment with parquet struct tags; it's a
+// separate type because the writer library drives its schema off tags
+// we don't want leaking into the domain type.
+type parquetRow struct {
+	Amount        float64 `parquet:"name=amount, type=DOUBLE"`
+	RequestedAt   int64   `parquet:"name=requested_at, type=INT64"`
+	ServiceUsed   string  `parquet:"name=service_used, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CorrelationId string  `parquet:"name=correlation_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// ParquetSink is a PaymentSink that archives settled payments as
+// Parquet files in S3, one object per flushed batch. rotateRows and
+// rotateTime only decide when the timestamp segment of the object keys
+// moves on (see nextKey).
+// It's meant for cold analytical workloads the OLTP database and
+// ClickHouseSink aren't a fit for.
+type ParquetSink struct {
+	s3Client *s3.Client
+	bucket   string
+	prefix   string
+
+	rotateRows int
+	rotateTime time.Duration
+
+	logger *slog.Logger
+	buf    *batchBuffer
+
+	mu       sync.Mutex
+	rows     int
+	openedAt time.Time
+	seq      uint64
+}
+
+func NewParquetSink(cfg SinkConfig, logger *slog.Logger) (*ParquetSink, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("workers: loading aws config for parquet sink: %w", err)
+	}
+
+	rotateRows := cfg.ParquetRotateRows
+	if rotateRows <= 0 {
+		rotateRows = 50_000
+	}
+	rotateTime := cfg.ParquetRotateTime
+	if rotateTime <= 0 {
+		rotateTime = 5 * time.Minute
+	}
+
+	p := &ParquetSink{
+		s3Client:   s3.NewFromConfig(awsCfg),
+		bucket:     cfg.S3Bucket,
+		prefix:     cfg.S3Prefix,
+		rotateRows: rotateRows,
+		rotateTime: rotateTime,
+		logger:     logger,
+		openedAt:   time.Time{},
+	}
+	p.buf = newBatchBuffer(cfg.BatchSize, cfg.BatchWindow, p.flush, logger)
+	return p, nil
+}
+
+func (p *ParquetSink) Push(payment payments.Payment, onDone func(error)) {
+	p.buf.push(payment, onDone)
+}
+
+func (p *ParquetSink) Flush(ctx context.Context) error {
+	return p.buf.flushNow(ctx)
+}
+
+func (p *ParquetSink) Close() error {
+	return nil
+}
+
+func (p *ParquetSink) BufferDepth() int {
+	return p.buf.depth()
+}
+
+// flush writes batch into its own, uniquely-keyed Parquet object under
+// prefix. Every flush gets its own object — nextKey's rotateRows/
+// rotateTime window only groups keys for discoverability, it never
+// reuses a key across flushes, so one flush's object can't be
+// overwritten by the next.
+func (p *ParquetSink) flush(ctx context.Context, batch []payments.Payment) error {
+	buf := buffer.NewBufferFile()
+	pw, err := writer.NewParquetWriter(buf, new(parquetRow), 4)
+	if err != nil {
+		p.logger.Error("failed to create parquet writer", "error", err)
+		return err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, payment := range batch {
+		row := parquetRow{
+			Amount:        payment.Amount,
+			RequestedAt:   payment.RequestedAt.UnixMilli(),
+			ServiceUsed:   string(payment.Processor),
+			CorrelationId: payment.CorrelationId,
+		}
+		if err := pw.Write(row); err != nil {
+			p.logger.Error("failed to write parquet row", "error", err)
+			return err
+		}
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		p.logger.Error("failed to finalize parquet file", "error", err)
+		return err
+	}
+
+	key := p.nextKey(len(batch))
+	_, err = p.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(key),
+		Body:   buf,
+	})
+	if err != nil {
+		p.logger.Error("failed to upload parquet archive", "error", err, "key", key)
+		return err
+	}
+
+	p.logger.Debug("Archived payment batch to S3", "bucket", p.bucket, "key", key, "rows", len(batch))
+	return nil
+}
+
+// nextKey returns a fresh object key for the next flush. The
+// rotateRows/rotateTime window only changes the timestamp segment of
+// the key (grouping flushes that belong to the same logical rotation
+// window for discoverability); the trailing sequence number is what
+// keeps every flush's key unique so one flush's object is never
+// overwritten by the next.
+func (p *ParquetSink) nextKey(rowCount int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.openedAt.IsZero() || p.rows >= p.rotateRows || now.Sub(p.openedAt) >= p.rotateTime {
+		p.openedAt = now
+		p.rows = 0
+	}
+	p.rows += rowCount
+	p.seq++
+
+	return fmt.Sprintf("%s/%s-%06d.parquet", p.prefix, p.openedAt.Format("20060102T150405.000000000"), p.seq)
+}
@@ -4,16 +4,41 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
 	"log/slog"
+	"math/rand"
 	"net/http"
+	"rinha/internal/metrics"
 	"rinha/internal/payments"
+	"rinha/internal/webhooks"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type ProcessorHealth struct {
 	Failing         bool  `json:"failing"`
 	MinResponseTime int64 `json:"minResponseTime"`
+
+	fee     float64
+	ewma    float64
+	breaker *circuitBreaker
+}
+
+// RoutingWeights tunes DetermineProcessor's cost-based selection: the
+// expected cost of sending a payment to a processor is
+// fee + LatencyWeight*ewmaLatencyMs + FailureWeight*recentFailureRate.
+// Epsilon is the fraction of calls that deliberately pick the
+// higher-cost processor anyway, so the monitor keeps sampling it for
+// recovery instead of starving it once it falls out of favor.
+type RoutingWeights struct {
+	LatencyWeight float64
+	FailureWeight float64
+	Epsilon       float64
 }
 
 type ProcessorHealthMonitor struct {
@@ -24,9 +49,17 @@ type ProcessorHealthMonitor struct {
 	done                     chan struct{}
 	processorsHealths        map[payments.ProcessorType]*ProcessorHealth
 	mu                       sync.RWMutex
+	webhooks                 *webhooks.Dispatcher
+	weights                  RoutingWeights
+
+	// healthCheckGroup coalesces concurrent checkProcessorHealth calls for
+	// the same URL into a single outbound request. In this package only
+	// StartMonitoring calls checkProcessorHealth, one URL at a time;
+	// CheckServiceAvailable reads breaker state and never polls.
+	healthCheckGroup singleflight.Group
 }
 
-func NewServiceMonitor(defaultServiceURL, fallbackServiceURL string, httpClient *http.Client, logger *slog.Logger) *ProcessorHealthMonitor {
+func NewServiceMonitor(defaultServiceURL, fallbackServiceURL string, httpClient *http.Client, logger *slog.Logger, dispatcher *webhooks.Dispatcher, defaultFee, fallbackFee float64, weights RoutingWeights) *ProcessorHealthMonitor {
 
 	monitor := &ProcessorHealthMonitor{
 		httpClient:               httpClient,
@@ -34,10 +67,12 @@ func NewServiceMonitor(defaultServiceURL, fallbackServiceURL string, httpClient
 		defaultServiceHealthURL:  defaultServiceURL,
 		fallbackServiceHealthURL: fallbackServiceURL,
 		processorsHealths:        make(map[payments.ProcessorType]*ProcessorHealth, 2),
+		webhooks:                 dispatcher,
+		weights:                  weights,
 	}
 
-	monitor.processorsHealths[payments.ProcessorTypeDefault] = &ProcessorHealth{}
-	monitor.processorsHealths[payments.ProcessorTypeFallback] = &ProcessorHealth{}
+	monitor.processorsHealths[payments.ProcessorTypeDefault] = &ProcessorHealth{fee: defaultFee, breaker: newCircuitBreaker(payments.ProcessorTypeDefault)}
+	monitor.processorsHealths[payments.ProcessorTypeFallback] = &ProcessorHealth{fee: fallbackFee, breaker: newCircuitBreaker(payments.ProcessorTypeFallback)}
 
 	return monitor
 }
@@ -68,53 +103,98 @@ func (m *ProcessorHealthMonitor) getServiceUrl(processorType payments.ProcessorT
 	}
 }
 
+// healthCheckResult is what checkProcessorHealth's singleflight-coalesced
+// request resolves to. It's a plain value rather than the *http.Response
+// itself, since every caller coalesced onto the same Do call receives the
+// same returned value and a shared response body can only be read once.
+type healthCheckResult struct {
+	statusCode int
+	health     ProcessorHealth
+}
+
+// checkProcessorHealth polls processorType's health endpoint, coalescing
+// concurrent callers for the same URL through m.healthCheckGroup so a
+// burst of callers produces one upstream request instead of one per
+// caller.
 func (m *ProcessorHealthMonitor) checkProcessorHealth(processorType payments.ProcessorType) {
 	healthURL := m.getServiceUrl(processorType)
 
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, healthURL, nil)
-	if err != nil {
-		m.logger.Error("Failed to create health check request", "url", healthURL, "error", err)
-		return
-	}
-
-	resp, err := m.httpClient.Do(req)
+	resultAny, err, _ := m.healthCheckGroup.Do(healthURL, func() (any, error) {
+		return m.fetchHealth(healthURL)
+	})
 	if err != nil {
 		m.logger.Warn("Health check request failed", "url", healthURL, "error", err)
 		return
 	}
 
-	if resp == nil {
-		m.logger.Warn("Health check request returned nil response", "url", healthURL)
+	result := resultAny.(healthCheckResult)
+	m.logger.Info("Health check response", "url", healthURL, "status", result.statusCode)
+
+	if result.statusCode != http.StatusOK {
+		m.logger.Warn("Health check returned non-OK status", "url", healthURL, "status", result.statusCode)
 		return
 	}
 
-	cacheStatus := resp.Header.Get("X-Cache-Status")
-	m.logger.Info("Health check response", "url", healthURL, "status", resp.StatusCode, "cacheStatus", cacheStatus)
+	m.updateServiceStatus(processorType, result.health.Failing, result.health.MinResponseTime)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		_ = resp.Body.Close()
-		m.logger.Warn("Health check returned non-OK status", "url", healthURL, "status", resp.StatusCode)
-		return
+// fetchHealth issues the actual GET (with jittered retry, since it's
+// idempotent) and fully drains/decodes the response before returning, so
+// the result is safe to hand to every caller singleflight coalesced onto
+// this call.
+func (m *ProcessorHealthMonitor) fetchHealth(healthURL string) (healthCheckResult, error) {
+	resp, err := payments.RetryGet(context.Background(), m.httpClient, healthURL, healthCheckMaxAttempts)
+	if err != nil {
+		return healthCheckResult{}, err
 	}
+	defer resp.Body.Close()
 
-	var health ProcessorHealth
-	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
-		_ = resp.Body.Close()
-		m.logger.Error("Failed to decode health check response", "url", healthURL, "error", err)
-		return
+	result := healthCheckResult{statusCode: resp.StatusCode}
+	if resp.StatusCode != http.StatusOK {
+		return result, nil
 	}
 
-	_ = resp.Body.Close()
-	m.updateServiceStatus(processorType, health.Failing, health.MinResponseTime)
+	if err := json.NewDecoder(resp.Body).Decode(&result.health); err != nil {
+		return healthCheckResult{}, fmt.Errorf("workers: decode health check response: %w", err)
+	}
+	return result, nil
 }
 
 func (m *ProcessorHealthMonitor) updateServiceStatus(processor payments.ProcessorType, failing bool, minResponseTime int64) {
 	m.mu.Lock()
-	m.processorsHealths[processor].Failing = failing
-	m.processorsHealths[processor].MinResponseTime = minResponseTime
+	health := m.processorsHealths[processor]
+	wasFailing := health.Failing
+	wasOverThreshold := health.ewma > maxAcceptableMinResponseTime
+	health.Failing = failing
+	health.MinResponseTime = minResponseTime
+	health.ewma = ewmaUpdate(health.ewma, float64(minResponseTime))
+	isOverThreshold := health.ewma > maxAcceptableMinResponseTime
+	ewma := health.ewma
 	m.mu.Unlock()
 
-	m.logger.Debug("Service status updated", "processor", processor, "failing", failing, "minResponseTime", minResponseTime)
+	m.logger.Debug("Service status updated", "processor", processor, "failing", failing, "minResponseTime", minResponseTime, "ewma", ewma)
+
+	if failing || isOverThreshold {
+		health.breaker.forceOpen()
+	}
+
+	if failing != wasFailing {
+		eventType := webhooks.EventProcessorFailing
+		if !failing {
+			eventType = webhooks.EventProcessorRecovered
+		}
+		m.webhooks.Emit(context.Background(), webhooks.Event{
+			Type: eventType,
+			Data: map[string]any{"processor": processor},
+		})
+	}
+
+	if isOverThreshold != wasOverThreshold {
+		m.webhooks.Emit(context.Background(), webhooks.Event{
+			Type: webhooks.EventProcessorThreshold,
+			Data: map[string]any{"processor": processor, "ewmaResponseTime": ewma},
+		})
+	}
 }
 
 // Stop stops the monitoring
@@ -128,39 +208,305 @@ var (
 )
 
 const (
+	// maxAcceptableMinResponseTime is the EWMA ceiling (ms), past which a
+	// processor's breaker is forced open regardless of its reported
+	// Failing flag.
 	maxAcceptableMinResponseTime = 120
+
+	ewmaAlpha = 0.2
+
+	// failureThreshold is the number of consecutive InformFailure calls
+	// a closed breaker tolerates before tripping OPEN.
+	failureThreshold = 3
+
+	baseCoolDown = 5 * time.Second
+	maxCoolDown  = 60 * time.Second
+
+	// probeBudget admits at most 1 in probeBudget requests while a
+	// breaker is HALF_OPEN.
+	probeBudget = 10
+
+	// successesToClose is how many consecutive half-open probe
+	// successes are required before the breaker closes again.
+	successesToClose = 3
+
+	// healthCheckMaxAttempts bounds RetryGet's attempts for a single health
+	// poll; a health check that can't complete within this is no worse off
+	// than waiting for the next ticker tick.
+	healthCheckMaxAttempts = 3
 )
 
+func ewmaUpdate(prev, sample float64) float64 {
+	if prev == 0 {
+		return sample
+	}
+	return ewmaAlpha*sample + (1-ewmaAlpha)*prev
+}
+
+type processorOption struct {
+	processorType payments.ProcessorType
+	health        *ProcessorHealth
+	cost          float64
+}
+
+// cost estimates the expected cost of sending the next payment to
+// health's processor: its fee, plus a latency penalty from the EWMA
+// response time, plus a failure penalty from how many consecutive
+// failures it's currently carrying (capped at 1x failureThreshold).
+func (m *ProcessorHealthMonitor) cost(health *ProcessorHealth) float64 {
+	failureRate := float64(health.breaker.consecutiveFailures.Load()) / float64(failureThreshold)
+	if failureRate > 1 {
+		failureRate = 1
+	}
+	return health.fee + m.weights.LatencyWeight*health.ewma + m.weights.FailureWeight*failureRate
+}
+
+// DetermineProcessor picks a processor to send the next payment to,
+// preferring whichever minimizes cost (fee + latency penalty + failure
+// penalty) and falling back to the other one when the cheaper
+// processor's circuit breaker denies the call. With probability
+// weights.Epsilon it deliberately prefers the costlier processor instead,
+// so the monitor keeps sampling it and can detect a recovery.
 func (m *ProcessorHealthMonitor) DetermineProcessor() (payments.ProcessorType, error) {
 	m.mu.RLock()
 	defaultHealth := m.processorsHealths[payments.ProcessorTypeDefault]
 	fallbackHealth := m.processorsHealths[payments.ProcessorTypeFallback]
 	m.mu.RUnlock()
 
-	defaultFailing := defaultHealth.Failing || defaultHealth.MinResponseTime > maxAcceptableMinResponseTime
-	fallbackFailing := fallbackHealth.Failing || fallbackHealth.MinResponseTime > maxAcceptableMinResponseTime
-
-	if defaultFailing && fallbackFailing {
-		return "", ErrBothProcessorsUnavailable
+	options := []processorOption{
+		{payments.ProcessorTypeDefault, defaultHealth, m.cost(defaultHealth)},
+		{payments.ProcessorTypeFallback, fallbackHealth, m.cost(fallbackHealth)},
 	}
+	sort.Slice(options, func(i, j int) bool { return options[i].cost < options[j].cost })
 
-	if defaultFailing {
-		return payments.ProcessorTypeFallback, nil
+	preferred, other := options[0], options[1]
+	if m.weights.Epsilon > 0 && rand.Float64() < m.weights.Epsilon {
+		preferred, other = other, preferred
 	}
 
-	if fallbackFailing {
-		return payments.ProcessorTypeDefault, nil
+	if preferred.health.breaker.allow() {
+		return preferred.processorType, nil
+	}
+	if other.health.breaker.allow() {
+		return other.processorType, nil
 	}
 
-	if defaultHealth.MinResponseTime <= (3 * fallbackHealth.MinResponseTime) {
-		return payments.ProcessorTypeDefault, nil
+	m.webhooks.Emit(context.Background(), webhooks.Event{Type: webhooks.EventProcessorsUnavailable})
+	return "", ErrBothProcessorsUnavailable
+}
+
+// BreakerStatus is a point-in-time snapshot of one processor's circuit
+// breaker, used by the /health/circuit admin endpoint.
+type BreakerStatus struct {
+	Processor           payments.ProcessorType `json:"processor"`
+	State               string                 `json:"state"`
+	EWMAResponseTimeMs  float64                `json:"ewmaResponseTimeMs"`
+	Failing             bool                   `json:"failing"`
+	ConsecutiveFailures int32                  `json:"consecutiveFailures"`
+}
+
+// BreakerSnapshot reports the current breaker state for every processor.
+func (m *ProcessorHealthMonitor) BreakerSnapshot() []BreakerStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]BreakerStatus, 0, len(m.processorsHealths))
+	for processor, health := range m.processorsHealths {
+		statuses = append(statuses, BreakerStatus{
+			Processor:           processor,
+			State:               health.breaker.stateName(),
+			EWMAResponseTimeMs:  health.ewma,
+			Failing:             health.Failing,
+			ConsecutiveFailures: health.breaker.consecutiveFailures.Load(),
+		})
 	}
+	return statuses
+}
+
+// CheckServiceAvailable reports whether processorType's circuit breaker
+// currently admits calls, without making an outbound HTTP request. It's
+// a thinner check than DetermineProcessor: callers that already know
+// which processor they want (rather than asking the monitor to pick the
+// cheaper one) use this to short-circuit before dialing out.
+func (m *ProcessorHealthMonitor) CheckServiceAvailable(processorType payments.ProcessorType) bool {
+	m.mu.RLock()
+	health := m.processorsHealths[processorType]
+	m.mu.RUnlock()
 
-	return payments.ProcessorTypeFallback, nil
+	return health.breaker.allow()
 }
 
+// InformFailure records a real payment-call failure against processorType,
+// tripping its breaker OPEN after failureThreshold consecutive failures
+// (or immediately, with a doubled cool-down, if the failure happened
+// during a HALF_OPEN probe).
 func (m *ProcessorHealthMonitor) InformFailure(processorType payments.ProcessorType) {
 	m.mu.Lock()
-	m.processorsHealths[processorType].Failing = true
+	health := m.processorsHealths[processorType]
+	wasFailing := health.Failing
+	health.Failing = true
 	m.mu.Unlock()
+
+	health.breaker.recordFailure()
+
+	if !wasFailing {
+		m.webhooks.Emit(context.Background(), webhooks.Event{
+			Type: webhooks.EventProcessorFailing,
+			Data: map[string]any{"processor": processorType},
+		})
+	}
+}
+
+// InformSuccess records a real payment-call success and its observed
+// round-trip time, feeding the EWMA used by DetermineProcessor and the
+// breaker's HALF_OPEN recovery count.
+func (m *ProcessorHealthMonitor) InformSuccess(processorType payments.ProcessorType, rttMs int64) {
+	m.mu.Lock()
+	health := m.processorsHealths[processorType]
+	health.Failing = false
+	health.ewma = ewmaUpdate(health.ewma, float64(rttMs))
+	m.mu.Unlock()
+
+	health.breaker.recordSuccess()
+}
+
+// breakerState is the state of a per-processor circuit breaker.
+type breakerState int32
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker gates calls to a single processor. Invariants:
+//   - the cool-down only grows (doubles, capped at maxCoolDown) across
+//     repeated HALF_OPEN failures, and resets to baseCoolDown on close,
+//     so it is monotonic under sustained failure;
+//   - at most one HALF_OPEN probe is ever in flight at a time, enforced
+//     via probeInFlight's compare-and-swap rather than a lock, so the
+//     probe budget is never exceeded under concurrent callers.
+type circuitBreaker struct {
+	processor           payments.ProcessorType
+	state               atomic.Int32
+	openedAt            atomic.Int64 // UnixNano
+	coolDown            atomic.Int64 // time.Duration
+	consecutiveFailures atomic.Int32
+	consecutiveSuccess  atomic.Int32
+	requestCounter      atomic.Int64
+	probeInFlight       atomic.Bool
+}
+
+func newCircuitBreaker(processor payments.ProcessorType) *circuitBreaker {
+	b := &circuitBreaker{processor: processor}
+	b.coolDown.Store(int64(baseCoolDown))
+	return b
+}
+
+// allow reports whether a call may be sent right now. While OPEN it
+// denies until the cool-down elapses, then moves to HALF_OPEN and admits
+// at most one in probeBudget requests, with never more than one
+// concurrent probe outstanding.
+func (b *circuitBreaker) allow() bool {
+	switch breakerState(b.state.Load()) {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		elapsed := time.Duration(time.Now().UnixNano() - b.openedAt.Load())
+		if elapsed < time.Duration(b.coolDown.Load()) {
+			return false
+		}
+		b.state.CompareAndSwap(int32(breakerOpen), int32(breakerHalfOpen))
+		return b.tryAdmitProbe()
+	case breakerHalfOpen:
+		return b.tryAdmitProbe()
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) stateName() string {
+	switch breakerState(b.state.Load()) {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+func (b *circuitBreaker) tryAdmitProbe() bool {
+	n := b.requestCounter.Add(1)
+	if n%probeBudget != 0 {
+		return false
+	}
+	return b.probeInFlight.CompareAndSwap(false, true)
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.consecutiveSuccess.Store(0)
+
+	switch breakerState(b.state.Load()) {
+	case breakerHalfOpen:
+		b.probeInFlight.Store(false)
+		prev := time.Duration(b.coolDown.Load())
+		doubled := prev * 2
+		if doubled > maxCoolDown {
+			doubled = maxCoolDown
+		}
+		b.trip(doubled)
+	case breakerClosed:
+		if b.consecutiveFailures.Add(1) >= failureThreshold {
+			b.trip(baseCoolDown)
+		}
+	}
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.consecutiveFailures.Store(0)
+
+	if breakerState(b.state.Load()) == breakerHalfOpen {
+		b.probeInFlight.Store(false)
+		if b.consecutiveSuccess.Add(1) >= successesToClose {
+			b.close()
+		}
+	}
+}
+
+// forceOpen trips the breaker from CLOSED when the health-check poll
+// reports the processor as failing or over the latency ceiling. It is a
+// no-op once the breaker is already OPEN or HALF_OPEN so it doesn't
+// clobber an in-progress cool-down or probe.
+func (b *circuitBreaker) forceOpen() {
+	if breakerState(b.state.Load()) == breakerClosed {
+		b.trip(baseCoolDown)
+	}
+}
+
+func (b *circuitBreaker) trip(coolDown time.Duration) {
+	b.coolDown.Store(int64(coolDown))
+	b.openedAt.Store(time.Now().UnixNano())
+	b.consecutiveFailures.Store(0)
+	b.consecutiveSuccess.Store(0)
+	b.state.Store(int32(breakerOpen))
+	b.recordTransition("open")
+}
+
+func (b *circuitBreaker) close() {
+	b.state.Store(int32(breakerClosed))
+	b.coolDown.Store(int64(baseCoolDown))
+	b.consecutiveFailures.Store(0)
+	b.consecutiveSuccess.Store(0)
+	b.recordTransition("closed")
+}
+
+func (b *circuitBreaker) recordTransition(state string) {
+	if metrics.CircuitBreakerTransitionsTotal == nil {
+		return
+	}
+	metrics.CircuitBreakerTransitionsTotal.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("processor", string(b.processor)),
+		attribute.String("state", state),
+	))
 }
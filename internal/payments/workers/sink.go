@@ -0,0 +1,227 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"rinha/internal/payments"
+)
+
+// PaymentSink abstracts where PaymentWorker hands settled payments off
+// to for persistence, so cmd/worker can target Postgres (OLTP),
+// ClickHouse, or an S3/Parquet archive purely through config, without
+// PaymentWorker depending on a concrete writer.
+type PaymentSink interface {
+	// Push buffers payment for the sink's next flush without waiting for
+	// that flush; DbBatcher with its WAL enabled does write (and, under
+	// FsyncAlways, fsync) the payment to disk before returning. onDone,
+	// if non-nil, is called exactly once with
+	// the outcome of the flush that eventually carries payment, so a
+	// caller can defer acking its source (e.g. a Redis stream entry)
+	// until persistence is actually confirmed.
+	Push(payment payments.Payment, onDone func(error))
+	// Flush drains the payments still queued in the sink's channel and
+	// writes them immediately, bypassing the batch size/window policy. A
+	// partial batch the background loop has already taken off the
+	// channel is not included; it goes out on its own size/window flush.
+	Flush(ctx context.Context) error
+	Close() error
+	// BufferDepth reports how many payments are queued in the sink's
+	// channel, for the payment_sink_buffer_depth gauge. A partial batch
+	// the background loop is already assembling is not counted.
+	BufferDepth() int
+}
+
+// SinkConfig selects and configures a PaymentSink implementation.
+type SinkConfig struct {
+	Driver      SinkDriver
+	BatchSize   int
+	BatchWindow time.Duration
+
+	ClickHouseURL   string
+	ClickHouseTable string
+
+	S3Bucket          string
+	S3Prefix          string
+	ParquetRotateRows int
+	ParquetRotateTime time.Duration
+
+	// WALEnabled turns on DbBatcher's write-ahead log, so a payment
+	// survives a crash between a processor call succeeding and the
+	// Postgres flush committing.
+	WALEnabled         bool
+	WALDir             string
+	WALFsyncPolicy     string
+	WALFsyncInterval   time.Duration
+	WALMaxSegmentBytes int64
+}
+
+type SinkDriver string
+
+const (
+	SinkDriverPostgres   SinkDriver = "postgres"
+	SinkDriverClickHouse SinkDriver = "clickhouse"
+	SinkDriverParquet    SinkDriver = "parquet"
+)
+
+// NewSink builds the PaymentSink selected by cfg.Driver, defaulting to
+// the Postgres pgx writer when unset.
+func NewSink(cfg SinkConfig, dbpool *pgxpool.Pool, logger *slog.Logger) (PaymentSink, error) {
+	switch cfg.Driver {
+	case "", SinkDriverPostgres:
+		return NewDbBatcher(cfg, dbpool, logger)
+	case SinkDriverClickHouse:
+		return NewClickHouseSink(cfg, logger)
+	case SinkDriverParquet:
+		return NewParquetSink(cfg, logger)
+	default:
+		return nil, fmt.Errorf("workers: unknown sink driver %q", cfg.Driver)
+	}
+}
+
+// bufferedPayment pairs a payment with the completion callback its
+// eventual flush must notify.
+type bufferedPayment struct {
+	payment payments.Payment
+	onDone  func(error)
+}
+
+// batchBuffer runs the buffer-then-flush loop shared by every PaymentSink
+// implementation, so batch size/window policy lives in one place instead
+// of being reimplemented per backend. Each sink supplies its own flushFn
+// to actually write a batch to its backend; batchBuffer takes care of
+// notifying each payment's onDone callback with the flush's outcome.
+type batchBuffer struct {
+	bufferCh chan bufferedPayment
+	size     int
+	window   time.Duration
+	flushFn  func(ctx context.Context, batch []payments.Payment) error
+	logger   *slog.Logger
+}
+
+func newBatchBuffer(size int, window time.Duration, flushFn func(ctx context.Context, batch []payments.Payment) error, logger *slog.Logger) *batchBuffer {
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	if window <= 0 {
+		window = defaultBatchWindow
+	}
+
+	b := &batchBuffer{
+		bufferCh: make(chan bufferedPayment, 10*size),
+		size:     size,
+		window:   window,
+		flushFn:  flushFn,
+		logger:   logger,
+	}
+	go b.run()
+	return b
+}
+
+const (
+	defaultBatchSize   = 100
+	defaultBatchWindow = 2 * time.Millisecond
+)
+
+func (b *batchBuffer) depth() int {
+	return len(b.bufferCh)
+}
+
+func (b *batchBuffer) push(payment payments.Payment, onDone func(error)) {
+	select {
+	case b.bufferCh <- bufferedPayment{payment: payment, onDone: onDone}:
+	default:
+		b.logger.Error("Sink buffer is full, dropping payment")
+		if onDone != nil {
+			onDone(fmt.Errorf("workers: sink buffer is full"))
+		}
+	}
+}
+
+func (b *batchBuffer) run() {
+	var (
+		batch   []bufferedPayment
+		timer   *time.Timer
+		timerCh <-chan time.Time
+	)
+
+	addToBatch := func(bp bufferedPayment) {
+		batch = append(batch, bp)
+		if len(batch) == 1 {
+			if timer == nil {
+				timer = time.NewTimer(b.window)
+			} else {
+				timer.Reset(b.window)
+			}
+			timerCh = timer.C
+		}
+		if len(batch) >= b.size {
+			b.flushBatch(batch)
+			batch = nil
+			timerCh = nil
+		}
+	}
+
+	for {
+		select {
+		case bp := <-b.bufferCh:
+			addToBatch(bp)
+		case <-timerCh:
+			if len(batch) > 0 {
+				b.flushBatch(batch)
+				batch = nil
+			}
+			timerCh = nil
+		}
+	}
+}
+
+// flushBatch hands batch's payments to flushFn and notifies every
+// onDone callback with the outcome, asynchronously so the caller loop
+// keeps accepting new payments while the write is in flight.
+func (b *batchBuffer) flushBatch(batch []bufferedPayment) {
+	go func(batch []bufferedPayment) {
+		payload := make([]payments.Payment, len(batch))
+		for i, bp := range batch {
+			payload[i] = bp.payment
+		}
+
+		err := b.flushFn(context.Background(), payload)
+		for _, bp := range batch {
+			if bp.onDone != nil {
+				bp.onDone(err)
+			}
+		}
+	}(batch)
+}
+
+// flushNow drains whatever is buffered and flushes it synchronously,
+// backing PaymentSink.Flush.
+func (b *batchBuffer) flushNow(ctx context.Context) error {
+	var batch []bufferedPayment
+	for {
+		select {
+		case bp := <-b.bufferCh:
+			batch = append(batch, bp)
+		default:
+			if len(batch) == 0 {
+				return nil
+			}
+			payload := make([]payments.Payment, len(batch))
+			for i, bp := range batch {
+				payload[i] = bp.payment
+			}
+			err := b.flushFn(ctx, payload)
+			for _, bp := range batch {
+				if bp.onDone != nil {
+					bp.onDone(err)
+				}
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package streamconsumer helps a Redis Streams consumer-group member
+// scale horizontally: it derives a collision-free consumer name and
+// reclaims entries left pending by consumers that died mid-processing,
+// so a crashed replica's in-flight batch isn't stranded forever.
+package streamconsumer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Name derives a consumer name from this process's hostname and PID, so
+// scaling worker replicas doesn't require assigning each one a distinct
+// ConsumerName through config.
+func Name() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown-host"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Handler processes a batch of stream entries that Reclaimer just took
+// ownership of via XCLAIM/XAUTOCLAIM, the same way the normal
+// XReadGroup loop processes freshly delivered ones — including acking
+// them once done. Without this, a claimed entry just changes owner
+// forever without ever being handed back to the worker.
+type Handler func(ctx context.Context, messages []redis.XMessage)
+
+// Reclaimer periodically steals stream entries idle longer than
+// minIdleTime away from other consumers in the group, via XPENDING plus
+// a targeted XCLAIM, and separately runs XAUTOCLAIM as a sweep so
+// entries the XPENDING scan misses are still eventually recovered.
+type Reclaimer struct {
+	client   *redis.Client
+	stream   string
+	group    string
+	consumer string
+	logger   *slog.Logger
+	handler  Handler
+
+	minIdleTime time.Duration
+	interval    time.Duration
+	batchSize   int64
+}
+
+func NewReclaimer(client *redis.Client, stream, group, consumer string, minIdleTime, interval time.Duration, logger *slog.Logger, handler Handler) *Reclaimer {
+	return &Reclaimer{
+		client:      client,
+		stream:      stream,
+		group:       group,
+		consumer:    consumer,
+		logger:      logger,
+		handler:     handler,
+		minIdleTime: minIdleTime,
+		interval:    interval,
+		batchSize:   100,
+	}
+}
+
+// Run sweeps for abandoned pending entries every interval until ctx is
+// done. It's meant to run in its own goroutine alongside the consumer's
+// normal XReadGroup loop.
+func (r *Reclaimer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reclaimPending(ctx)
+			r.autoClaimSweep(ctx)
+		}
+	}
+}
+
+// reclaimPending lists entries idle longer than minIdleTime via XPENDING
+// and steals the ones not already owned by this consumer with XCLAIM.
+func (r *Reclaimer) reclaimPending(ctx context.Context) {
+	pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: r.stream,
+		Group:  r.group,
+		Idle:   r.minIdleTime,
+		Start:  "-",
+		End:    "+",
+		Count:  r.batchSize,
+	}).Result()
+	if err != nil {
+		r.logger.Error("XPENDING failed", "stream", r.stream, "group", r.group, "err", err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if p.Consumer == r.consumer {
+			continue
+		}
+		ids = append(ids, p.ID)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	claimed, err := r.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   r.stream,
+		Group:    r.group,
+		Consumer: r.consumer,
+		MinIdle:  r.minIdleTime,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		r.logger.Error("XCLAIM failed", "stream", r.stream, "group", r.group, "err", err)
+		return
+	}
+	if len(claimed) > 0 {
+		r.logger.Info("Reclaimed pending entries from other consumers", "count", len(claimed), "consumer", r.consumer)
+		r.handler(ctx, claimed)
+	}
+}
+
+// autoClaimSweep runs XAUTOCLAIM as a continuous garbage-collection pass,
+// catching entries reclaimPending's XPENDING scan could miss (e.g. one
+// belonging to a consumer that's since been removed from the group).
+func (r *Reclaimer) autoClaimSweep(ctx context.Context) {
+	cursor := "0-0"
+	for {
+		msgs, next, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   r.stream,
+			Group:    r.group,
+			Consumer: r.consumer,
+			MinIdle:  r.minIdleTime,
+			Start:    cursor,
+			Count:    r.batchSize,
+		}).Result()
+		if err != nil {
+			r.logger.Error("XAUTOCLAIM failed", "stream", r.stream, "group", r.group, "err", err)
+			return
+		}
+
+		if len(msgs) > 0 {
+			r.logger.Info("Auto-claimed abandoned stream entries", "count", len(msgs), "consumer", r.consumer)
+			r.handler(ctx, msgs)
+		}
+
+		if next == "0-0" || int64(len(msgs)) < r.batchSize {
+			return
+		}
+		cursor = next
+	}
+}
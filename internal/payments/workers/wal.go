@@ -0,0 +1,426 @@
+package workers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"rinha/internal/payments"
+)
+
+// FsyncPolicy controls how aggressively WAL.Append durably flushes a
+// record to disk before returning, trading latency for how much a crash
+// right after a write can lose.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways fsyncs on every Append; safest, slowest.
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval fsyncs on a background timer; a crash can lose up to
+	// one interval's worth of writes.
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNone relies on the OS page cache flushing on its own schedule.
+	FsyncNone FsyncPolicy = "none"
+)
+
+const (
+	defaultWALMaxSegmentBytes = 64 * 1024 * 1024
+	defaultWALFsyncInterval   = 200 * time.Millisecond
+	walMaxSegments            = 8
+)
+
+// WALConfig configures a WAL instance.
+type WALConfig struct {
+	Dir             string
+	FsyncPolicy     FsyncPolicy
+	FsyncInterval   time.Duration
+	MaxSegmentBytes int64
+}
+
+// WALEntry is one payment staged for a flush, identified by a
+// monotonically increasing sequence number so Ack can discard it once the
+// sink confirms it was written.
+type WALEntry struct {
+	Seq     uint64
+	Payment payments.Payment
+}
+
+// WAL is an append-only, segmented write-ahead log that DbBatcher.Push
+// writes a payment to before handing it to the in-memory batchBuffer, so a
+// crash between a processor call succeeding and the Postgres flush
+// committing doesn't lose the payment: on restart, Pending() returns
+// every record still in a segment file on disk so it can be replayed
+// through the normal flush path. Acks are kept in memory only, so
+// records acked before the restart are returned too unless their rotated
+// segment file had already been deleted.
+type WAL struct {
+	dir             string
+	fsyncPolicy     FsyncPolicy
+	maxSegmentBytes int64
+	logger          *slog.Logger
+
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	nextSeq uint64
+	pending map[uint64]WALEntry
+
+	// segmentOf and segmentPending track which segment (0 for the active
+	// segment, 1..walMaxSegments for rotated ".NNN" files) each pending
+	// seq currently lives in, so Ack can delete a rotated segment's file
+	// as soon as every entry it holds is acked, instead of waiting for
+	// the entire WAL to drain -- one slow payment in segment 2 shouldn't
+	// block reclaiming segment 5 just because both were rotated before
+	// it was acked.
+	segmentOf      map[uint64]int
+	segmentPending map[int]int
+
+	// rotatedSegments is an informational count of ".NNN" files currently
+	// on disk, used only for logging; reclaim decisions are driven by
+	// segmentPending instead.
+	rotatedSegments int
+
+	done chan struct{}
+}
+
+func NewWAL(cfg WALConfig, logger *slog.Logger) (*WAL, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("workers: wal: create dir: %w", err)
+	}
+
+	maxSegmentBytes := cfg.MaxSegmentBytes
+	if maxSegmentBytes <= 0 {
+		maxSegmentBytes = defaultWALMaxSegmentBytes
+	}
+
+	w := &WAL{
+		dir:             cfg.Dir,
+		fsyncPolicy:     cfg.FsyncPolicy,
+		maxSegmentBytes: maxSegmentBytes,
+		logger:          logger,
+		pending:         make(map[uint64]WALEntry),
+		segmentOf:       make(map[uint64]int),
+		segmentPending:  make(map[int]int),
+		done:            make(chan struct{}),
+	}
+
+	if err := w.replay(); err != nil {
+		return nil, err
+	}
+	if err := w.openActiveSegment(); err != nil {
+		return nil, err
+	}
+
+	if w.fsyncPolicy == FsyncInterval {
+		interval := cfg.FsyncInterval
+		if interval <= 0 {
+			interval = defaultWALFsyncInterval
+		}
+		go w.fsyncLoop(interval)
+	}
+
+	return w, nil
+}
+
+func (w *WAL) activePath() string {
+	return filepath.Join(w.dir, "payments.wal")
+}
+
+func (w *WAL) segmentPath(n int) string {
+	return filepath.Join(w.dir, fmt.Sprintf("payments.wal.%03d", n))
+}
+
+func (w *WAL) openActiveSegment() error {
+	f, err := os.OpenFile(w.activePath(), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("workers: wal: open active segment: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("workers: wal: stat active segment: %w", err)
+	}
+
+	w.file = f
+	w.writer = bufio.NewWriter(f)
+	w.size = info.Size()
+	return nil
+}
+
+// replay reads every segment left behind by a prior process — oldest
+// rotated segment first, then the active one — and hydrates pending with
+// every record found in them, so Pending() can replay them through the
+// normal flush path. Which records were acked before the crash is not
+// known here, so acked records still on disk are replayed as well.
+func (w *WAL) replay() error {
+	var maxSeq uint64
+	for n := walMaxSegments; n >= 1; n-- {
+		seen, err := w.replaySegment(w.segmentPath(n), n, &maxSeq)
+		if err != nil {
+			return err
+		}
+		if seen {
+			w.rotatedSegments++
+		}
+	}
+	if _, err := w.replaySegment(w.activePath(), 0, &maxSeq); err != nil {
+		return err
+	}
+
+	w.nextSeq = maxSeq + 1
+	if len(w.pending) > 0 {
+		w.logger.Info("WAL replay recovered unflushed payments", "count", len(w.pending))
+	}
+	return nil
+}
+
+// replaySegment reads one segment file's records into pending, attributing
+// each to segment (0 for the active file, 1..walMaxSegments for a rotated
+// one) so Ack can reclaim rotated segments recovered at startup the same
+// way it reclaims ones rotated during this process's lifetime. It reports
+// whether the file existed at all.
+func (w *WAL) replaySegment(path string, segment int, maxSeq *uint64) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("workers: wal: open %s for replay: %w", path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		seq, payment, err := readWALRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			w.logger.Warn("WAL replay stopped on truncated record", "path", path, "err", err)
+			break
+		}
+		w.pending[seq] = WALEntry{Seq: seq, Payment: payment}
+		w.segmentOf[seq] = segment
+		w.segmentPending[segment]++
+		if seq > *maxSeq {
+			*maxSeq = seq
+		}
+	}
+	return true, nil
+}
+
+func readWALRecord(r *bufio.Reader) (uint64, payments.Payment, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, payments.Payment{}, err
+	}
+
+	seq := binary.BigEndian.Uint64(header[:8])
+	length := binary.BigEndian.Uint32(header[8:])
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, payments.Payment{}, io.ErrUnexpectedEOF
+	}
+
+	var payment payments.Payment
+	if err := json.Unmarshal(buf, &payment); err != nil {
+		return 0, payments.Payment{}, fmt.Errorf("workers: wal: decode record: %w", err)
+	}
+	return seq, payment, nil
+}
+
+// ErrWALSegmentsFull is returned by Append once the active segment has
+// hit maxSegmentBytes and the oldest rotated slot (".NNN" with NNN =
+// walMaxSegments) still holds un-acked entries, so there is nowhere left
+// to rotate into. Rotating anyway would overwrite that segment, losing
+// its un-acked entries outright. Callers should surface this as a write
+// failure (DbBatcher.Push already does) until every entry in that oldest
+// segment is acked.
+var ErrWALSegmentsFull = errors.New("workers: wal: segments full, ack required before more writes")
+
+// Append stages payment in the WAL and returns the sequence number that
+// must later be passed to Ack once it's durably written to the sink.
+func (w *WAL) Append(payment payments.Payment) (uint64, error) {
+	body, err := json.Marshal(payment)
+	if err != nil {
+		return 0, fmt.Errorf("workers: wal: encode record: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size >= w.maxSegmentBytes && w.segmentPending[walMaxSegments] > 0 {
+		return 0, ErrWALSegmentsFull
+	}
+
+	seq := w.nextSeq
+	w.nextSeq++
+
+	var header [12]byte
+	binary.BigEndian.PutUint64(header[:8], seq)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(body)))
+
+	if _, err := w.writer.Write(header[:]); err != nil {
+		return 0, fmt.Errorf("workers: wal: write header: %w", err)
+	}
+	if _, err := w.writer.Write(body); err != nil {
+		return 0, fmt.Errorf("workers: wal: write body: %w", err)
+	}
+	if err := w.writer.Flush(); err != nil {
+		return 0, fmt.Errorf("workers: wal: flush: %w", err)
+	}
+	if w.fsyncPolicy == FsyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return 0, fmt.Errorf("workers: wal: fsync: %w", err)
+		}
+	}
+
+	w.size += int64(len(header) + len(body))
+	w.pending[seq] = WALEntry{Seq: seq, Payment: payment}
+	w.segmentOf[seq] = 0
+	w.segmentPending[0]++
+
+	if w.size >= w.maxSegmentBytes {
+		if err := w.rotate(); err != nil {
+			if errors.Is(err, ErrWALSegmentsFull) {
+				w.logger.Warn("WAL rotation deferred, oldest rotated segment still awaiting ack", "rotatedSegments", w.rotatedSegments)
+			} else {
+				w.logger.Error("WAL rotation failed", "err", err)
+			}
+		}
+	}
+
+	return seq, nil
+}
+
+// Ack discards a staged entry once the sink has confirmed it was written.
+// A rotated segment is deleted as soon as its own entries are all acked,
+// independent of whether other segments still have entries pending -- a
+// single slow or never-acked payment in one segment must not block
+// reclaiming every other already-acked rotated segment.
+func (w *WAL) Ack(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segment, ok := w.segmentOf[seq]
+	if !ok {
+		return
+	}
+	delete(w.pending, seq)
+	delete(w.segmentOf, seq)
+	w.segmentPending[segment]--
+
+	if segment == 0 || w.segmentPending[segment] > 0 {
+		return
+	}
+	delete(w.segmentPending, segment)
+
+	if err := os.Remove(w.segmentPath(segment)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		w.logger.Error("WAL segment truncation failed", "segment", segment, "err", err)
+	}
+}
+
+// Pending returns a snapshot of entries still awaiting ack, in ascending
+// sequence order, so NewDbBatcher can replay them through the normal flush
+// path on startup.
+func (w *WAL) Pending() []WALEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entries := make([]WALEntry, 0, len(w.pending))
+	for _, e := range w.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries
+}
+
+// rotate closes the active segment, shifts existing ".NNN" segments up by
+// one, and opens a fresh active segment. Callers hold w.mu. It refuses
+// to run while the oldest slot (walMaxSegments) still holds un-acked
+// entries: the shift-by-one below would overwrite that segment.
+func (w *WAL) rotate() error {
+	if w.segmentPending[walMaxSegments] > 0 {
+		return ErrWALSegmentsFull
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	for n := walMaxSegments - 1; n >= 1; n-- {
+		_ = os.Rename(w.segmentPath(n), w.segmentPath(n+1))
+	}
+	_ = os.Remove(w.segmentPath(walMaxSegments + 1))
+	if err := os.Rename(w.activePath(), w.segmentPath(1)); err != nil {
+		return err
+	}
+	w.shiftSegments()
+	if w.rotatedSegments < walMaxSegments {
+		w.rotatedSegments++
+	}
+
+	return w.openActiveSegment()
+}
+
+// shiftSegments renumbers segmentOf/segmentPending to match the rename
+// loop above: what was the active segment (0) becomes segment 1, and
+// every rotated segment n becomes n+1. Callers hold w.mu and have
+// already verified segmentPending[walMaxSegments] is 0, so this never
+// drops an unacked entry's bookkeeping.
+func (w *WAL) shiftSegments() {
+	segmentOf := make(map[uint64]int, len(w.segmentOf))
+	for seq, segment := range w.segmentOf {
+		segmentOf[seq] = segment + 1
+	}
+	w.segmentOf = segmentOf
+
+	segmentPending := make(map[int]int, len(w.segmentPending))
+	for segment, count := range w.segmentPending {
+		segmentPending[segment+1] = count
+	}
+	w.segmentPending = segmentPending
+}
+
+func (w *WAL) fsyncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			_ = w.file.Sync()
+			w.mu.Unlock()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *WAL) Close() error {
+	close(w.done)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
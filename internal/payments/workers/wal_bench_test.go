@@ -0,0 +1,59 @@
+package workers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"rinha/internal/payments"
+)
+
+// BenchmarkDbBatcherPush_WALEnabled and BenchmarkDbBatcherPush_ChannelOnly
+// compare the per-payment cost DbBatcher.Push adds in its WAL-enabled
+// branch (WAL.Append before buf.push; the benchmark Acks each entry
+// right after appending it rather than on flush) against the plain
+// channel-only branch it falls back to when no WAL is configured, so
+// the durability/latency trade-off chunk2-6 introduces is measurable
+// rather than assumed.
+func BenchmarkDbBatcherPush_WALEnabled(b *testing.B) {
+	dir := b.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	wal, err := NewWAL(WALConfig{Dir: dir, FsyncPolicy: FsyncNone, MaxSegmentBytes: 1 << 30}, logger)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer wal.Close()
+
+	buf := newBatchBuffer(1000, 50*time.Millisecond, func(ctx context.Context, batch []payments.Payment) error {
+		return nil
+	}, logger)
+
+	payment := payments.Payment{Amount: 19.90, CorrelationId: "bench", RequestedAt: time.Now()}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		seq, err := wal.Append(payment)
+		if err != nil {
+			b.Fatal(err)
+		}
+		wal.Ack(seq)
+		buf.push(payment, nil)
+	}
+}
+
+func BenchmarkDbBatcherPush_ChannelOnly(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	buf := newBatchBuffer(1000, 50*time.Millisecond, func(ctx context.Context, batch []payments.Payment) error {
+		return nil
+	}, logger)
+
+	payment := payments.Payment{Amount: 19.90, CorrelationId: "bench", RequestedAt: time.Now()}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.push(payment, nil)
+	}
+}
@@ -8,34 +8,132 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	"log/slog"
+	"rinha/internal/metrics"
 	"rinha/internal/payments"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	initialConcurrencyLimit = 50
+	minConcurrencyLimit     = 5
+	maxConcurrencyLimit     = 200
+
+	// additiveIncreaseEvery is how many consecutive successes the limiter
+	// needs to see before it grows the limit by one.
+	additiveIncreaseEvery = 20
+)
+
+// adaptiveLimiter is an AIMD-style concurrency limiter: it grows the
+// number of admitted in-flight calls by one after a run of sustained
+// successes, and halves it immediately on a timeout/5xx/429, so a
+// processor brownout doesn't get hit by a thundering herd of retries
+// while the other lane stays usable. It's sized in calls, not goroutines,
+// so acquire/release must bracket exactly the outbound HTTP call.
+type adaptiveLimiter struct {
+	inFlight      atomic.Int32
+	limit         atomic.Int32
+	successStreak atomic.Int32
+}
+
+func newAdaptiveLimiter() *adaptiveLimiter {
+	l := &adaptiveLimiter{}
+	l.limit.Store(initialConcurrencyLimit)
+	return l
+}
+
+// acquire blocks until fewer than the current limit of calls are in
+// flight. The limit can shrink out from under already-admitted callers;
+// that's intentional, since congestion should drain rather than abort.
+func (l *adaptiveLimiter) acquire() {
+	for {
+		cur := l.inFlight.Load()
+		if cur < l.limit.Load() && l.inFlight.CompareAndSwap(cur, cur+1) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (l *adaptiveLimiter) release() {
+	l.inFlight.Add(-1)
+}
+
+// InFlight reports the limiter's current in-flight call count, for the
+// payment_processor_inflight gauge.
+func (l *adaptiveLimiter) InFlight() int64 {
+	return int64(l.inFlight.Load())
+}
+
+// onSuccess additively grows the limit by one every additiveIncreaseEvery
+// consecutive successes, capped at maxConcurrencyLimit.
+func (l *adaptiveLimiter) onSuccess() {
+	if l.successStreak.Add(1)%additiveIncreaseEvery != 0 {
+		return
+	}
+	for {
+		cur := l.limit.Load()
+		if cur >= maxConcurrencyLimit {
+			return
+		}
+		if l.limit.CompareAndSwap(cur, cur+1) {
+			return
+		}
+	}
+}
+
+// onCongestion multiplicatively halves the limit, floored at
+// minConcurrencyLimit, and resets the success streak so growth has to be
+// re-earned instead of resuming from where it left off.
+func (l *adaptiveLimiter) onCongestion() {
+	l.successStreak.Store(0)
+	for {
+		cur := l.limit.Load()
+		next := cur / 2
+		if next < minConcurrencyLimit {
+			next = minConcurrencyLimit
+		}
+		if cur <= next || l.limit.CompareAndSwap(cur, next) {
+			return
+		}
+	}
+}
+
 type PaymentWorker struct {
 	defaultPaymentService  *payments.PaymentService
 	fallbackPaymentService *payments.PaymentService
 	serviceMonitor         *ServiceMonitor
 	logger                 *slog.Logger
-	dbBatcher              *DbBatcher
+	sink                   PaymentSink
 	redisClient            *redis.Client
+	limiter                *adaptiveLimiter
+	deduper                *Deduper
+	requestTimeout         time.Duration
 
 	messagesTotal     int64
 	messagesFailed    int64
 	messagesSucceeded int64
 }
 
-func NewPaymentWorker(defaultPaymentService *payments.PaymentService, fallbackPaymentService *payments.PaymentService, logger *slog.Logger, serviceMonitor *ServiceMonitor, dbBatcher *DbBatcher, redisClient *redis.Client) *PaymentWorker {
+func NewPaymentWorker(defaultPaymentService *payments.PaymentService, fallbackPaymentService *payments.PaymentService, logger *slog.Logger, serviceMonitor *ServiceMonitor, sink PaymentSink, redisClient *redis.Client, requestTimeout time.Duration) *PaymentWorker {
+	if requestTimeout <= 0 {
+		requestTimeout = 800 * time.Millisecond
+	}
+
 	o := &PaymentWorker{
 		defaultPaymentService:  defaultPaymentService,
 		fallbackPaymentService: fallbackPaymentService,
 		serviceMonitor:         serviceMonitor,
 		logger:                 logger,
-		dbBatcher:              dbBatcher,
+		sink:                   sink,
 		redisClient:            redisClient,
+		limiter:                newAdaptiveLimiter(),
+		deduper:                NewDeduper(redisClient),
+		requestTimeout:         requestTimeout,
 		messagesTotal:          0,
 		messagesFailed:         0,
 		messagesSucceeded:      0,
@@ -44,6 +142,12 @@ func NewPaymentWorker(defaultPaymentService *payments.PaymentService, fallbackPa
 	return o
 }
 
+// InFlight reports the worker's current outbound processor call count, for
+// the payment_processor_inflight gauge.
+func (w *PaymentWorker) InFlight() int64 {
+	return w.limiter.InFlight()
+}
+
 type workFactorBalancer struct {
 	target   map[payments.ServiceType]int // target work
 	current  map[payments.ServiceType]int // actual delivered
@@ -100,7 +204,17 @@ func (b *workFactorBalancer) NextService() payments.ServiceType {
 	return payments.ServiceTypeFallback
 }
 
-func (w *PaymentWorker) Process(messages []payments.PaymentMessage) {
+// Process settles messages against the processors and hands successes to
+// the sink, returning the persistence error (if any) for every message
+// keyed by CorrelationId, so the caller's XAck only covers messages that
+// actually made it to durable storage. A CorrelationId absent from the
+// returned map settled and persisted cleanly, was skipped as a duplicate
+// of an already-claimed CorrelationId, was handed off to
+// retryFailedPayment/deadLetter (which re-enter a stream under a fresh
+// entry), or failed with an error other than
+// payments.ErrUnavailableProcessor, which is not retried; its entry is
+// acked in every one of these cases.
+func (w *PaymentWorker) Process(messages []payments.PaymentMessage) map[string]error {
 	ctx := context.Background()
 	tr := otel.Tracer("worker")
 	ctx, span := tr.Start(ctx, "process-batch")
@@ -111,18 +225,19 @@ func (w *PaymentWorker) Process(messages []payments.PaymentMessage) {
 	if err != nil {
 		for _, msg := range messages {
 			m := msg
-			w.retryFailedPayment(ctx, m)
+			w.retryFailedPayment(ctx, m, "work_factor_calculation_failed", err)
 		}
-		return
+		return nil
 	}
 
-	const maxConcurrentRequests = 50
-	sem := make(chan struct{}, maxConcurrentRequests)
-
 	var (
 		wg        sync.WaitGroup
+		sinkWg    sync.WaitGroup
+		drainWg   sync.WaitGroup
 		successCh = make(chan payments.Payment, len(messages))
-		retryCh   = make(chan payments.PaymentMessage, len(messages))
+		retryCh   = make(chan retryItem, len(messages))
+		failedMu  sync.Mutex
+		failed    = make(map[string]error)
 	)
 
 	span.SetAttributes(
@@ -145,6 +260,22 @@ func (w *PaymentWorker) Process(messages []payments.PaymentMessage) {
 
 		defer wg.Done()
 
+		if err := w.deduper.Claim(ctx, m.CorrelationId); err != nil {
+			if errors.Is(err, ErrDuplicatePayment) {
+				w.logger.Debug("Skipping duplicate payment", "correlationId", m.CorrelationId)
+				return
+			}
+			w.logger.Warn("dedup check failed, proceeding without dedup guard", "correlationId", m.CorrelationId, "error", err)
+		}
+
+		// A claim kept across a retry would make the retried stream entry
+		// look like a duplicate of itself, so it's released first.
+		releaseClaim := func() {
+			if err := w.redisClient.Del(ctx, dedupKey(m.CorrelationId)).Err(); err != nil {
+				w.logger.Warn("failed to release dedup claim", "correlationId", m.CorrelationId, "error", err)
+			}
+		}
+
 		defaultAvailable := w.serviceMonitor.CheckServiceAvailable(payments.ServiceTypeDefault)
 		fallbackAvailable := w.serviceMonitor.CheckServiceAvailable(payments.ServiceTypeFallback)
 
@@ -160,14 +291,15 @@ func (w *PaymentWorker) Process(messages []payments.PaymentMessage) {
 			targetService = w.defaultPaymentService
 			serviceType = payments.ServiceTypeDefault
 		} else {
-			retryCh <- m
+			releaseClaim()
+			retryCh <- retryItem{msg: m, reason: "no_service_available", cause: ErrBothProcessorsUnavailable}
 			return
 		}
 
 		span.SetAttributes(attribute.String("actual_service_type", string(serviceType)))
 
-		sem <- struct{}{}
-		defer func() { <-sem }()
+		w.limiter.acquire()
+		defer w.limiter.release()
 
 		ctx2, span2 := tr.Start(ctx, "call-payment-service",
 			trace.WithAttributes(
@@ -178,6 +310,12 @@ func (w *PaymentWorker) Process(messages []payments.PaymentMessage) {
 		)
 		defer span2.End()
 
+		// Bounding the call with requestTimeout means a processor that's
+		// gone quiet doesn't tie up an adaptiveLimiter slot indefinitely;
+		// the caller sees this as an ordinary failure and retries.
+		ctx2, cancel := context.WithTimeout(ctx2, w.requestTimeout)
+		defer cancel()
+
 		err := targetService.Process(ctx2, m)
 
 		if err != nil {
@@ -186,15 +324,19 @@ func (w *PaymentWorker) Process(messages []payments.PaymentMessage) {
 			if errors.Is(err, payments.ErrUnavailableProcessor) {
 				w.logger.Error("Payment service unavailable", "service", serviceType, "error", err)
 				w.serviceMonitor.InformFailure(serviceType)
-				retryCh <- m
+				w.limiter.onCongestion()
+				releaseClaim()
+				retryCh <- retryItem{msg: m, reason: "processor_unavailable", cause: err}
 			}
 			return
 		}
 
+		w.limiter.onSuccess()
+
 		successCh <- payments.Payment{
 			Amount:        m.Amount,
 			RequestedAt:   m.RequestedAt,
-			ServiceUsed:   serviceType,
+			Processor:     payments.ProcessorType(serviceType),
 			CorrelationId: m.CorrelationId,
 		}
 	}
@@ -209,34 +351,78 @@ func (w *PaymentWorker) Process(messages []payments.PaymentMessage) {
 		go processMessage(m, serviceType)
 	}
 
+	drainWg.Add(2)
 	go func() {
+		defer drainWg.Done()
 		for payment := range successCh {
 			p := payment
-			w.dbBatcher.PushPayment(p)
+			sinkWg.Add(1)
+			w.sink.Push(p, func(err error) {
+				defer sinkWg.Done()
+				if err != nil {
+					w.logger.Error("Failed to persist payment, ack will be withheld",
+						"correlationId", p.CorrelationId, "error", err)
+					failedMu.Lock()
+					failed[p.CorrelationId] = err
+					failedMu.Unlock()
+					// Released so the reclaimer's redelivery of the unacked
+					// entry isn't skipped as a duplicate.
+					_ = w.redisClient.Del(ctx, dedupKey(p.CorrelationId)).Err()
+				}
+			})
 		}
 	}()
 
 	go func() {
-		for msg := range retryCh {
-			m := msg
-			w.retryFailedPayment(ctx, m)
+		defer drainWg.Done()
+		for item := range retryCh {
+			i := item
+			w.retryFailedPayment(ctx, i.msg, i.reason, i.cause)
 		}
 	}()
 
 	wg.Wait()
 	close(successCh)
 	close(retryCh)
+	drainWg.Wait()
+
+	// Waiting for every sink push's completion callback before returning
+	// means failed points, not just persisted ones, are already recorded
+	// in failed by the time the caller inspects the returned map.
+	sinkWg.Wait()
+
+	return failed
+}
+
+// retryItem carries a message back for retry alongside why it failed,
+// so a message that exhausts its retries can be dead-lettered with a
+// reason instead of just a warning log line.
+type retryItem struct {
+	msg    payments.PaymentMessage
+	reason string
+	cause  error
 }
 
-func (w *PaymentWorker) retryFailedPayment(ctx context.Context, msg payments.PaymentMessage) {
+// dlqStream is where messages that exceed maxRetries are parked instead
+// of being dropped, so they survive the process and can be inspected or
+// replayed via the DLQ admin endpoint.
+const dlqStream = "payments:dlq"
+
+func (w *PaymentWorker) retryFailedPayment(ctx context.Context, msg payments.PaymentMessage, reason string, cause error) {
+	if metrics.RetriesTotal != nil {
+		metrics.RetriesTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+	}
+
 	go func() {
 		msg.RetryCount++
 
 		const maxRetries = 10
 		if msg.RetryCount > maxRetries {
-			w.logger.Warn("Maximum retry attempts reached, dropping message",
+			w.logger.Warn("Maximum retry attempts reached, moving to dead-letter stream",
 				"correlationId", msg.CorrelationId,
-				"retryCount", msg.RetryCount)
+				"retryCount", msg.RetryCount,
+				"reason", reason)
+			w.deadLetter(ctx, msg, reason, cause)
 			return
 		}
 
@@ -269,3 +455,36 @@ func (w *PaymentWorker) retryFailedPayment(ctx context.Context, msg payments.Pay
 		}).Result()
 	}()
 }
+
+// deadLetter XADDs msg to dlqStream along with why it's being given up
+// on, so it isn't silently lost and can be inspected or replayed later
+// through the DLQ admin endpoint.
+func (w *PaymentWorker) deadLetter(ctx context.Context, msg payments.PaymentMessage, reason string, cause error) {
+	if metrics.DLQPushesTotal != nil {
+		metrics.DLQPushesTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		w.logger.Error("error while marshalling dead-lettered payment", "error", err)
+		return
+	}
+
+	lastErr := ""
+	if cause != nil {
+		lastErr = cause.Error()
+	}
+
+	_, err = w.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: dlqStream,
+		Values: map[string]interface{}{
+			"data":      string(data),
+			"reason":    reason,
+			"lastError": lastErr,
+		},
+	}).Result()
+	if err != nil {
+		w.logger.Error("Failed to write to dead-letter stream",
+			"correlationId", msg.CorrelationId, "error", err)
+	}
+}
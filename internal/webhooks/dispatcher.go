@@ -0,0 +1,138 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	deliveryQueueSize   = 4096
+	maxDeliveryAttempts = 8
+	baseRetryDelay      = 500 * time.Millisecond
+	maxRetryDelay       = 5 * time.Minute
+)
+
+type delivery struct {
+	sub     Subscription
+	event   Event
+	attempt int
+}
+
+// Dispatcher delivers Events to every Subscription registered for them,
+// signing each body with HMAC-SHA256 and retrying failed deliveries with
+// exponential backoff, up to maxDeliveryAttempts retries. A subscriber
+// may receive the same event more than once if it acknowledges late. The
+// queue lives in memory only: a delivery is dropped when the queue is
+// full, when its retries are used up, or when the process exits.
+type Dispatcher struct {
+	store      *Store
+	httpClient *http.Client
+	logger     *slog.Logger
+	queue      chan delivery
+}
+
+func NewDispatcher(store *Store, httpClient *http.Client, logger *slog.Logger) *Dispatcher {
+	d := &Dispatcher{
+		store:      store,
+		httpClient: httpClient,
+		logger:     logger,
+		queue:      make(chan delivery, deliveryQueueSize),
+	}
+	go d.run()
+	return d
+}
+
+// Emit looks up every subscription registered for evt.Type and enqueues a
+// delivery for each. It never blocks the caller on a slow subscriber.
+func (d *Dispatcher) Emit(ctx context.Context, evt Event) {
+	if d == nil {
+		return
+	}
+
+	evt.Timestamp = time.Now().UTC()
+
+	subs, err := d.store.ListForEvent(ctx, evt.Type)
+	if err != nil {
+		d.logger.Error("failed to list webhook subscriptions", "event", evt.Type, "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		d.enqueue(delivery{sub: sub, event: evt})
+	}
+}
+
+func (d *Dispatcher) enqueue(del delivery) {
+	select {
+	case d.queue <- del:
+	default:
+		d.logger.Warn("webhook delivery queue full, dropping delivery",
+			"subscription", del.sub.ID, "event", del.event.Type)
+	}
+}
+
+func (d *Dispatcher) run() {
+	for del := range d.queue {
+		d.deliver(del)
+	}
+}
+
+func (d *Dispatcher) deliver(del delivery) {
+	body, err := json.Marshal(del.event)
+	if err != nil {
+		d.logger.Error("failed to marshal webhook event", "error", err)
+		return
+	}
+
+	mac := hmac.New(sha256.New, []byte(del.sub.Secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequest(http.MethodPost, del.sub.URL, bytes.NewReader(body))
+	if err != nil {
+		d.logger.Error("failed to build webhook request", "subscription", del.sub.ID, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", "sha256="+signature)
+
+	resp, err := d.httpClient.Do(req)
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err == nil && resp.StatusCode < 300 {
+		return
+	}
+
+	d.retry(del)
+}
+
+func (d *Dispatcher) retry(del delivery) {
+	del.attempt++
+	if del.attempt > maxDeliveryAttempts {
+		d.logger.Warn("giving up on webhook delivery after max attempts",
+			"subscription", del.sub.ID, "event", del.event.Type, "attempts", del.attempt)
+		return
+	}
+
+	delay := backoff(del.attempt)
+	time.AfterFunc(delay, func() {
+		d.enqueue(del)
+	})
+}
+
+func backoff(attempt int) time.Duration {
+	delay := baseRetryDelay * (1 << uint(attempt))
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
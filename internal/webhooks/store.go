@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store persists webhook subscriptions in Postgres.
+type Store struct {
+	dbpool *pgxpool.Pool
+}
+
+func NewStore(dbpool *pgxpool.Pool) *Store {
+	return &Store{dbpool: dbpool}
+}
+
+func newSubscriptionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Store) Create(ctx context.Context, url string, eventTypes []EventType, secret string) (*Subscription, error) {
+	types := make([]string, len(eventTypes))
+	for i, t := range eventTypes {
+		types[i] = string(t)
+	}
+
+	sub := &Subscription{
+		ID:         newSubscriptionID(),
+		URL:        url,
+		EventTypes: eventTypes,
+		Secret:     secret,
+	}
+
+	_, err := s.dbpool.Exec(ctx,
+		`INSERT INTO webhook_subscriptions (id, url, event_types, secret, created_at)
+		 VALUES ($1, $2, $3, $4, now())`,
+		sub.ID, sub.URL, types, sub.Secret,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	_, err := s.dbpool.Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	return err
+}
+
+// ListForEvent returns every subscription registered for eventType.
+func (s *Store) ListForEvent(ctx context.Context, eventType EventType) ([]Subscription, error) {
+	rows, err := s.dbpool.Query(ctx,
+		`SELECT id, url, event_types, secret, created_at
+		 FROM webhook_subscriptions
+		 WHERE $1 = ANY(event_types)`,
+		string(eventType),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		var (
+			sub   Subscription
+			types []string
+		)
+		if err := rows.Scan(&sub.ID, &sub.URL, &types, &sub.Secret, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, t := range types {
+			sub.EventTypes = append(sub.EventTypes, EventType(t))
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
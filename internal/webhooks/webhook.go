@@ -0,0 +1,33 @@
+package webhooks
+
+import "time"
+
+// EventType names a webhook-eligible occurrence emitted by the health
+// monitor or the worker pool.
+type EventType string
+
+const (
+	EventProcessorFailing      EventType = "processor.failing"
+	EventProcessorRecovered    EventType = "processor.recovered"
+	EventProcessorThreshold    EventType = "processor.threshold_crossed"
+	EventProcessorsUnavailable EventType = "processor.both_unavailable"
+	EventPaymentSucceeded      EventType = "payment.succeeded"
+	EventPaymentFailed         EventType = "payment.failed"
+)
+
+// Subscription is an external URL registered to receive a subset of
+// EventType occurrences, signed with Secret.
+type Subscription struct {
+	ID         string
+	URL        string
+	EventTypes []EventType
+	Secret     string
+	CreatedAt  time.Time
+}
+
+// Event is the JSON body delivered to a subscriber.
+type Event struct {
+	Type      EventType      `json:"type"`
+	Timestamp time.Time      `json:"timestamp"`
+	Data      map[string]any `json:"data"`
+}
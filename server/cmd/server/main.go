@@ -50,12 +50,26 @@ func main() {
 	// Create the payment store
 	pStore := payments.NewPaymentStore(dbpool, logger)
 
-	socket := "/tmp/payments-stream.sock"
-	publisher, err := messages.NewPublisher(socket, 4) // até 4 conexões mantidas
+	transportDriver, err := messages.New(messages.Config{
+		Driver:         messages.Driver(appConfig.Messages.Driver),
+		UnixSocketPath: appConfig.Messages.UnixSocketPath,
+		UnixMaxConns:   appConfig.Messages.UnixMaxConns,
+		RedisURL:       appConfig.Messages.RedisURL,
+		RedisChannel:   appConfig.Messages.RedisChannel,
+	}, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	var publisher messages.Transport = transportDriver
+	if messages.Driver(appConfig.Messages.Driver) == messages.DriverUnix || appConfig.Messages.Driver == "" {
+		outbox, err := messages.NewOutbox(appConfig.Messages.UnixOutboxDir, logger)
+		if err != nil {
+			log.Fatal(err)
+		}
+		publisher = messages.NewOutboxPublisher(transportDriver, outbox, logger)
+	}
+
 	mux := http.NewServeMux()
 	paymentHandler := handlers.NewPaymentHandler(publisher)
 	summaryHandler := handlers.NewSummaryHandler(pStore, httpClient)
@@ -69,7 +83,7 @@ func main() {
 	})
 
 	_ = os.Remove(appConfig.Server.Socket)
-	
+
 	l, err := net.Listen("unix", appConfig.Server.Socket)
 	if err != nil {
 		log.Fatal(err)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"log"
 	"log/slog"
 	"net"
@@ -13,6 +14,9 @@ import (
 	"rinha/internal/messages"
 	"rinha/internal/payments"
 	"rinha/internal/payments/workers"
+	"rinha/internal/webhooks"
+	"rinha/server/internal/payments/handlers"
+	workerpool "rinha/server/internal/payments/workers"
 	"time"
 )
 
@@ -53,26 +57,82 @@ func main() {
 
 	pStore := payments.NewPaymentStore(dbpool, logger)
 
-	healthMonitor := workers.NewServiceMonitor(appConfig.Service.DefaultHealthURL, appConfig.Service.FallbackHealthURL, httpClient, logger)
+	redisClient := setupRedisClient(appConfig)
+
+	webhookDispatcher := webhooks.NewDispatcher(webhooks.NewStore(dbpool), httpClient, logger)
+
+	routingWeights := workers.RoutingWeights{
+		LatencyWeight: appConfig.Service.RoutingLatencyWeight,
+		FailureWeight: appConfig.Service.RoutingFailureWeight,
+		Epsilon:       appConfig.Service.RoutingEpsilon,
+	}
+	healthMonitor := workers.NewServiceMonitor(appConfig.Service.DefaultHealthURL, appConfig.Service.FallbackHealthURL, httpClient, logger, webhookDispatcher, appConfig.Service.DefaultFee, appConfig.Service.FallbackFee, routingWeights)
 	go healthMonitor.StartMonitoring()
 
-	workerPool := workers.NewWorkerPool(defaultProcessor, fallbackProcessor, pStore, logger, healthMonitor)
+	workerPool := workerpool.NewWorkerPool(defaultProcessor, fallbackProcessor, pStore, logger, healthMonitor, webhookDispatcher, redisClient)
 	go workerPool.Start()
 	defer workerPool.Stop()
 
-	socket := "/tmp/payments-stream.sock"
-
-	// --- start consumer (único) ---
-	receiver := messages.NewReceiver(socket, workerPool, logger)
-
-	err = receiver.Start()
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/dead-letter/replay", handlers.NewDeadLetterHandler(workerPool))
+	adminMux.Handle("/health/circuit", handlers.NewCircuitHandler(healthMonitor))
+	adminMux.Handle("/metrics", handlers.NewMetricsHandler(workerPool))
+	go func() {
+		addr := fmt.Sprintf(":%d", appConfig.Admin.Port)
+		if err := http.ListenAndServe(addr, adminMux); err != nil {
+			logger.Error("Admin HTTP listener stopped", "err", err)
+		}
+	}()
+
+	// The Source abstraction lets this one main.go consume UDS frames or
+	// a Redis Stream by driver config alone, instead of forking a
+	// separate worker entrypoint per topology.
+	source, err := messages.NewSource(messages.Config{
+		Driver:            messages.Driver(appConfig.Messages.Driver),
+		UnixSocketPath:    appConfig.Messages.UnixSocketPath,
+		UnixMaxConns:      appConfig.Messages.UnixMaxConns,
+		RedisURL:          appConfig.Messages.RedisURL,
+		RedisStreamName:   appConfig.Messages.RedisStreamName,
+		RedisStreamGroup:  appConfig.Messages.RedisStreamGroup,
+		RedisConsumerName: appConfig.Messages.RedisConsumerName,
+	}, logger)
 	if err != nil {
-		logger.Error("Failed to start receiver", "err", err)
+		logger.Error("Failed to build messages source", "err", err)
 		os.Exit(1)
-		return
 	}
+	defer source.Close()
 
-	defer receiver.Stop()
+	consumeSource(context.Background(), source, workerPool, logger)
+}
+
+// consumeSource pulls batches off source for as long as the process runs,
+// logging and polling again when Next fails. It submits each message to
+// pool and only acks the batch once every message has been handed off, so
+// a crash before ack redelivers it; a batch with a message Submit dropped
+// is left unacked.
+func consumeSource(ctx context.Context, source messages.Source, pool *workerpool.WorkerPool, logger *slog.Logger) {
+	for {
+		msgs, ack, err := source.Next(ctx)
+		if err != nil {
+			logger.Error("Failed to pull next batch", "err", err)
+			continue
+		}
+
+		handedOff := true
+		for i := range msgs {
+			if !pool.Submit(&msgs[i]) {
+				handedOff = false
+			}
+		}
+		if !handedOff {
+			logger.Warn("Batch not fully handed off, leaving it unacked", "size", len(msgs))
+			continue
+		}
+
+		if err := ack(ctx); err != nil {
+			logger.Error("Failed to ack batch", "err", err)
+		}
+	}
 }
 
 func setupDbPool(appConfig *config.AppConfig) *pgxpool.Pool {
@@ -86,6 +146,15 @@ func setupDbPool(appConfig *config.AppConfig) *pgxpool.Pool {
 	return dbpool
 }
 
+func setupRedisClient(appConfig *config.AppConfig) *redis.Client {
+	opt, err := redis.ParseURL(appConfig.Redis.URL)
+	if err != nil {
+		log.Fatalf("Failed to parse Redis URL: %v", err)
+	}
+
+	return redis.NewClient(opt)
+}
+
 func setupLogger() *slog.Logger {
 	logLevel := slog.LevelWarn
 
@@ -15,17 +15,62 @@ type PostgresConfig struct {
 	URL string `mapstructure:"url"`
 }
 
+// RedisConfig is used for the dedup SETNX pre-check in WorkerPool.process;
+// it's independent of MessagesConfig.RedisURL, which backs the Redis
+// transport driver.
+type RedisConfig struct {
+	URL string `mapstructure:"url"`
+}
+
+// AdminConfig configures the worker process's admin HTTP listener, used
+// for operational endpoints like dead-letter replay that act directly on
+// the WorkerPool rather than going through the payments transport.
+type AdminConfig struct {
+	Port int `mapstructure:"port"`
+}
+
 type ServiceConfig struct {
 	DefaultURL        string `mapstructure:"default_url"`
 	DefaultHealthURL  string `mapstructure:"default_health_url"`
 	FallbackURL       string `mapstructure:"fallback_url"`
 	FallbackHealthURL string `mapstructure:"fallback_health_url"`
+
+	DefaultFee  float64 `mapstructure:"default_fee"`
+	FallbackFee float64 `mapstructure:"fallback_fee"`
+
+	// RoutingLatencyWeight/RoutingFailureWeight/RoutingEpsilon tune
+	// ProcessorHealthMonitor's cost-based DetermineProcessor; see
+	// workers.RoutingWeights.
+	RoutingLatencyWeight float64 `mapstructure:"routing_latency_weight"`
+	RoutingFailureWeight float64 `mapstructure:"routing_failure_weight"`
+	RoutingEpsilon       float64 `mapstructure:"routing_epsilon"`
+}
+
+type MessagesConfig struct {
+	Driver string `mapstructure:"driver"`
+
+	UnixSocketPath string `mapstructure:"unix_socket_path"`
+	UnixMaxConns   int    `mapstructure:"unix_max_conns"`
+	UnixOutboxDir  string `mapstructure:"unix_outbox_dir"`
+
+	RedisURL     string `mapstructure:"redis_url"`
+	RedisChannel string `mapstructure:"redis_channel"`
+
+	// RedisStreamName/RedisStreamGroup/RedisConsumerName configure the
+	// Redis Streams Source/Sink, used instead of RedisChannel's Pub/Sub
+	// Transport when consumer-group ack/claim semantics are wanted.
+	RedisStreamName   string `mapstructure:"redis_stream_name"`
+	RedisStreamGroup  string `mapstructure:"redis_stream_group"`
+	RedisConsumerName string `mapstructure:"redis_consumer_name"`
 }
 
 type AppConfig struct {
 	Server   *ServerConfig   `mapstructure:"server"`
 	Postgres *PostgresConfig `mapstructure:"postgres"`
 	Service  *ServiceConfig  `mapstructure:"service"`
+	Messages *MessagesConfig `mapstructure:"messages"`
+	Admin    *AdminConfig    `mapstructure:"admin"`
+	Redis    *RedisConfig    `mapstructure:"redis"`
 }
 
 func LoadConfig() (*AppConfig, error) {
@@ -36,6 +81,21 @@ func LoadConfig() (*AppConfig, error) {
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("service.default_url", "http://localhost:8001/payments")
 	viper.SetDefault("service.fallback_url", "http://localhost:8002/payments")
+	viper.SetDefault("service.default_fee", 0.05)
+	viper.SetDefault("service.fallback_fee", 0.15)
+	viper.SetDefault("service.routing_latency_weight", 0.001)
+	viper.SetDefault("service.routing_failure_weight", 0.5)
+	viper.SetDefault("service.routing_epsilon", 0.05)
+	viper.SetDefault("messages.driver", "unix")
+	viper.SetDefault("messages.unix_socket_path", "/tmp/payments-stream.sock")
+	viper.SetDefault("messages.unix_max_conns", 4)
+	viper.SetDefault("messages.unix_outbox_dir", "/tmp/payments-outbox")
+	viper.SetDefault("messages.redis_channel", "payments-stream")
+	viper.SetDefault("messages.redis_stream_name", "payments-stream")
+	viper.SetDefault("messages.redis_stream_group", "payments-workers")
+	viper.SetDefault("messages.redis_consumer_name", "worker-1")
+	viper.SetDefault("admin.port", 9001)
+	viper.SetDefault("redis.url", "redis://localhost:6379")
 
 	_ = viper.BindEnv("server.port", "SERVER_PORT")
 	_ = viper.BindEnv("server.host", "SERVER_HOST")
@@ -44,7 +104,23 @@ func LoadConfig() (*AppConfig, error) {
 	_ = viper.BindEnv("service.fallback_url", "SERVICE_FALLBACK_URL")
 	_ = viper.BindEnv("service.default_health_url", "SERVICE_DEFAULT_HEALTH_URL")
 	_ = viper.BindEnv("service.fallback_health_url", "SERVICE_FALLBACK_HEALTH_URL")
+	_ = viper.BindEnv("service.default_fee", "SERVICE_DEFAULT_FEE")
+	_ = viper.BindEnv("service.fallback_fee", "SERVICE_FALLBACK_FEE")
+	_ = viper.BindEnv("service.routing_latency_weight", "SERVICE_ROUTING_LATENCY_WEIGHT")
+	_ = viper.BindEnv("service.routing_failure_weight", "SERVICE_ROUTING_FAILURE_WEIGHT")
+	_ = viper.BindEnv("service.routing_epsilon", "SERVICE_ROUTING_EPSILON")
 	_ = viper.BindEnv("server.socket", "SERVER_SOCKET")
+	_ = viper.BindEnv("messages.driver", "MESSAGES_DRIVER")
+	_ = viper.BindEnv("messages.unix_socket_path", "MESSAGES_UNIX_SOCKET_PATH")
+	_ = viper.BindEnv("messages.unix_max_conns", "MESSAGES_UNIX_MAX_CONNS")
+	_ = viper.BindEnv("messages.unix_outbox_dir", "MESSAGES_UNIX_OUTBOX_DIR")
+	_ = viper.BindEnv("messages.redis_url", "MESSAGES_REDIS_URL")
+	_ = viper.BindEnv("messages.redis_channel", "MESSAGES_REDIS_CHANNEL")
+	_ = viper.BindEnv("messages.redis_stream_name", "MESSAGES_REDIS_STREAM_NAME")
+	_ = viper.BindEnv("messages.redis_stream_group", "MESSAGES_REDIS_STREAM_GROUP")
+	_ = viper.BindEnv("messages.redis_consumer_name", "MESSAGES_REDIS_CONSUMER_NAME")
+	_ = viper.BindEnv("admin.port", "ADMIN_PORT")
+	_ = viper.BindEnv("redis.url", "REDIS_URL")
 
 	var config AppConfig
 	if err := viper.Unmarshal(&config); err != nil {
@@ -0,0 +1,300 @@
+package messages
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	// outboxMaxSizeBytes rotates the active segment once it grows past
+	// this, mirroring the ".NNN" rotation scheme access loggers use.
+	outboxMaxSizeBytes = 64 * 1024 * 1024
+	outboxMaxSegments  = 8
+)
+
+// outboxEntry is one pending publish, identified by a monotonically
+// increasing sequence number so the receiver can ack it back by ID.
+type outboxEntry struct {
+	seq uint64
+	msg []byte
+}
+
+// Outbox is an append-only, crash-safe staging log for messages awaiting
+// transport delivery. OutboxPublisher appends to it before attempting the
+// socket send, and only discards an entry once the receiver's ack for it
+// arrives. Acks are kept in memory only: on restart, replay re-stages
+// every record still on disk, so entries acked since they were written
+// are resent along with the ones that never got acked.
+type Outbox struct {
+	dir    string
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	nextSeq uint64
+	pending map[uint64]outboxEntry
+
+	// rotatedSegments counts ".001".."00N" files currently on disk, so
+	// Ack can reclaim them once every entry is acked instead of letting
+	// fully-flushed segments sit around until the next rotation evicts
+	// them.
+	rotatedSegments int
+}
+
+func NewOutbox(dir string, logger *slog.Logger) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("outbox: create dir: %w", err)
+	}
+
+	o := &Outbox{dir: dir, logger: logger, pending: make(map[uint64]outboxEntry)}
+	if err := o.replay(); err != nil {
+		return nil, err
+	}
+	if err := o.openActiveSegment(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *Outbox) activePath() string {
+	return filepath.Join(o.dir, "outbox.log")
+}
+
+func (o *Outbox) segmentPath(n int) string {
+	return filepath.Join(o.dir, fmt.Sprintf("outbox.log.%03d", n))
+}
+
+func (o *Outbox) openActiveSegment() error {
+	f, err := os.OpenFile(o.activePath(), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("outbox: open active segment: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("outbox: stat active segment: %w", err)
+	}
+
+	o.file = f
+	o.writer = bufio.NewWriter(f)
+	o.size = info.Size()
+	return nil
+}
+
+// replay reads every segment left behind by a prior process — oldest
+// rotated segment first, then the active one — and hydrates pending with
+// every record in them. Acks were never written to disk, so records acked
+// before the restart come back too unless Ack had already deleted their
+// rotated segment.
+func (o *Outbox) replay() error {
+	var maxSeq uint64
+	paths := make([]string, 0, outboxMaxSegments+1)
+	for n := outboxMaxSegments; n >= 1; n-- {
+		paths = append(paths, o.segmentPath(n))
+	}
+	paths = append(paths, o.activePath())
+
+	for _, path := range paths {
+		seen, err := o.replaySegment(path, &maxSeq)
+		if err != nil {
+			return err
+		}
+		if seen && path != o.activePath() {
+			o.rotatedSegments++
+		}
+	}
+
+	o.nextSeq = maxSeq + 1
+	if len(o.pending) > 0 {
+		o.logger.Info("Outbox replay recovered entries", "count", len(o.pending))
+	}
+	return nil
+}
+
+// replaySegment reads one segment file's records into pending, reporting
+// whether the file existed at all.
+func (o *Outbox) replaySegment(path string, maxSeq *uint64) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("outbox: open %s for replay: %w", path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		seq, msg, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			o.logger.Warn("Outbox replay stopped on truncated record", "path", path, "err", err)
+			break
+		}
+		o.pending[seq] = outboxEntry{seq: seq, msg: msg}
+		if seq > *maxSeq {
+			*maxSeq = seq
+		}
+	}
+	return true, nil
+}
+
+func readRecord(r *bufio.Reader) (uint64, []byte, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	seq := binary.BigEndian.Uint64(header[:8])
+	length := binary.BigEndian.Uint32(header[8:])
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return seq, buf, nil
+}
+
+// ErrOutboxSegmentsFull is returned by Append once the active segment has
+// hit outboxMaxSizeBytes and outboxMaxSegments rotated segments are on
+// disk, so there is nowhere left to rotate into. Rotating anyway would
+// overwrite the oldest rotated segment, which can still hold un-acked
+// entries -- losing them outright. Rotated segments are deleted only when
+// an Ack leaves nothing pending at all, so Append keeps failing until
+// then.
+var ErrOutboxSegmentsFull = errors.New("outbox: segments full, ack required before more writes")
+
+// Append stages msg in the outbox and returns the sequence number the
+// receiver must ack to have it discarded.
+func (o *Outbox) Append(msg []byte) (uint64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.size >= outboxMaxSizeBytes && o.rotatedSegments >= outboxMaxSegments {
+		return 0, ErrOutboxSegmentsFull
+	}
+
+	seq := o.nextSeq
+	o.nextSeq++
+
+	var header [12]byte
+	binary.BigEndian.PutUint64(header[:8], seq)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(msg)))
+
+	if _, err := o.writer.Write(header[:]); err != nil {
+		return 0, fmt.Errorf("outbox: write header: %w", err)
+	}
+	if _, err := o.writer.Write(msg); err != nil {
+		return 0, fmt.Errorf("outbox: write body: %w", err)
+	}
+	if err := o.writer.Flush(); err != nil {
+		return 0, fmt.Errorf("outbox: flush: %w", err)
+	}
+
+	o.size += int64(len(header) + len(msg))
+
+	cp := make([]byte, len(msg))
+	copy(cp, msg)
+	o.pending[seq] = outboxEntry{seq: seq, msg: cp}
+
+	if o.size >= outboxMaxSizeBytes {
+		if err := o.rotate(); err != nil {
+			if errors.Is(err, ErrOutboxSegmentsFull) {
+				o.logger.Warn("Outbox rotation deferred, all rotated segments still on disk", "rotatedSegments", o.rotatedSegments)
+			} else {
+				o.logger.Error("Outbox rotation failed", "err", err)
+			}
+		}
+	}
+
+	return seq, nil
+}
+
+// Ack discards a staged entry once the receiver has confirmed delivery.
+// Once nothing is left pending, any rotated segments are safe to delete
+// outright, since every record they held has been durably acked.
+func (o *Outbox) Ack(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.pending, seq)
+	if len(o.pending) > 0 {
+		return
+	}
+
+	for n := 1; n <= o.rotatedSegments; n++ {
+		if err := os.Remove(o.segmentPath(n)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			o.logger.Error("Outbox segment truncation failed", "segment", n, "err", err)
+			return
+		}
+	}
+	o.rotatedSegments = 0
+}
+
+// Pending returns a snapshot of entries still awaiting ack, in ascending
+// sequence order, for the background flusher to resend.
+func (o *Outbox) Pending() []outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]outboxEntry, 0, len(o.pending))
+	for _, e := range o.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	return entries
+}
+
+// rotate closes the active segment, shifts existing ".NNN" segments up by
+// one, and opens a fresh active segment. Callers hold o.mu. It refuses
+// to run once outboxMaxSegments are already rotated: the shift-by-one
+// below has nowhere to put the oldest segment without overwriting it,
+// and that segment can still hold un-acked entries.
+func (o *Outbox) rotate() error {
+	if o.rotatedSegments >= outboxMaxSegments {
+		return ErrOutboxSegmentsFull
+	}
+
+	if err := o.writer.Flush(); err != nil {
+		return err
+	}
+	if err := o.file.Close(); err != nil {
+		return err
+	}
+
+	for n := outboxMaxSegments - 1; n >= 1; n-- {
+		_ = os.Rename(o.segmentPath(n), o.segmentPath(n+1))
+	}
+	_ = os.Remove(o.segmentPath(outboxMaxSegments + 1))
+	if err := os.Rename(o.activePath(), o.segmentPath(1)); err != nil {
+		return err
+	}
+	if o.rotatedSegments < outboxMaxSegments {
+		o.rotatedSegments++
+	}
+
+	return o.openActiveSegment()
+}
+
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.writer.Flush(); err != nil {
+		return err
+	}
+	return o.file.Close()
+}
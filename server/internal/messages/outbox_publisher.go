@@ -0,0 +1,113 @@
+package messages
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// flushInterval is how often the background flusher retries entries
+	// still awaiting an ack (e.g. because the receiver was down or a
+	// send failed).
+	flushInterval = 200 * time.Millisecond
+	// flushAckTimeout bounds how long the flusher waits for a single
+	// entry's ack. A NACKed entry is skipped for this run; a send that
+	// fails or times out ends the run, leaving the rest for the next tick.
+	flushAckTimeout = 200 * time.Millisecond
+)
+
+// OutboxPublisher wraps a Transport with a durable outbox: every publish
+// is staged to disk before the socket send, and discarded only once the
+// receiver's ack for it arrives. A background flusher retries whatever is
+// still pending, so a receiver restart (or a dropped connection) replays
+// unacked entries instead of losing them. Transports that don't
+// implement AckPublisher are treated as fire-and-forget: the outbox entry
+// is discarded right after the send attempt. With an AckPublisher
+// transport a NACK is not passed on: PublishContext returns nil, never
+// ErrBackpressure, and the flusher resends the entry.
+type OutboxPublisher struct {
+	transport Transport
+	outbox    *Outbox
+	logger    *slog.Logger
+	done      chan struct{}
+}
+
+func NewOutboxPublisher(transport Transport, outbox *Outbox, logger *slog.Logger) *OutboxPublisher {
+	p := &OutboxPublisher{transport: transport, outbox: outbox, logger: logger, done: make(chan struct{})}
+	go p.flushLoop()
+	return p
+}
+
+func (p *OutboxPublisher) Publish(msg []byte) error {
+	return p.PublishContext(context.Background(), msg)
+}
+
+func (p *OutboxPublisher) PublishContext(ctx context.Context, msg []byte) error {
+	seq, err := p.outbox.Append(msg)
+	if err != nil {
+		return err
+	}
+
+	ap, ok := p.transport.(AckPublisher)
+	if !ok {
+		err := p.transport.PublishContext(ctx, msg)
+		p.outbox.Ack(seq)
+		return err
+	}
+
+	acked, err := ap.PublishAck(ctx, seq, msg)
+	if err != nil {
+		return err
+	}
+	if acked {
+		p.outbox.Ack(seq)
+	} else {
+		p.logger.Debug("Outbox entry not acked on first send, flusher will retry", "seq", seq)
+	}
+	return nil
+}
+
+func (p *OutboxPublisher) Subscribe(handler func([]byte) bool) error {
+	return p.transport.Subscribe(handler)
+}
+
+func (p *OutboxPublisher) Close() error {
+	close(p.done)
+	return p.transport.Close()
+}
+
+func (p *OutboxPublisher) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.flush()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *OutboxPublisher) flush() {
+	ap, ok := p.transport.(AckPublisher)
+	if !ok {
+		return
+	}
+
+	for _, entry := range p.outbox.Pending() {
+		ctx, cancel := context.WithTimeout(context.Background(), flushAckTimeout)
+		acked, err := ap.PublishAck(ctx, entry.seq, entry.msg)
+		cancel()
+
+		if err != nil {
+			p.logger.Debug("Outbox flush send failed", "seq", entry.seq, "err", err)
+			return
+		}
+		if acked {
+			p.outbox.Ack(entry.seq)
+		}
+	}
+}
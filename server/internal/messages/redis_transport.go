@@ -0,0 +1,56 @@
+package messages
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisTransport is the networked Transport implementation: it publishes
+// to, and subscribes on, a single Redis Pub/Sub channel so the API and
+// worker processes can run on different hosts without a shared socket.
+type RedisTransport struct {
+	client  *redis.Client
+	channel string
+	logger  *slog.Logger
+	sub     *redis.PubSub
+}
+
+func NewRedisTransport(url, channel string, logger *slog.Logger) (*RedisTransport, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisTransport{
+		client:  redis.NewClient(opt),
+		channel: channel,
+		logger:  logger,
+	}, nil
+}
+
+func (t *RedisTransport) Publish(msg []byte) error {
+	return t.PublishContext(context.Background(), msg)
+}
+
+func (t *RedisTransport) PublishContext(ctx context.Context, msg []byte) error {
+	return t.client.Publish(ctx, t.channel, msg).Err()
+}
+
+// Subscribe ignores handler's accepted/rejected return: Pub/Sub has no
+// back-channel to the publisher, so there's nothing to NACK.
+func (t *RedisTransport) Subscribe(handler func([]byte) bool) error {
+	t.sub = t.client.Subscribe(context.Background(), t.channel)
+	for msg := range t.sub.Channel() {
+		handler([]byte(msg.Payload))
+	}
+	return nil
+}
+
+func (t *RedisTransport) Close() error {
+	if t.sub != nil {
+		_ = t.sub.Close()
+	}
+	return t.client.Close()
+}
@@ -0,0 +1,38 @@
+package messages
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisStreamSink appends payment submissions to a Redis Stream via
+// XAdd, for workers to consume as a durable consumer group.
+type redisStreamSink struct {
+	client *redis.Client
+	stream string
+}
+
+func newRedisStreamSink(cfg Config, logger *slog.Logger) (*redisStreamSink, error) {
+	opt, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisStreamSink{
+		client: redis.NewClient(opt),
+		stream: cfg.RedisStreamName,
+	}, nil
+}
+
+func (s *redisStreamSink) Submit(ctx context.Context, raw []byte) error {
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		Values: map[string]any{"data": raw},
+	}).Err()
+}
+
+func (s *redisStreamSink) Close() error {
+	return s.client.Close()
+}
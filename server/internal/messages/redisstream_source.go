@@ -0,0 +1,106 @@
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"rinha/internal/payments"
+)
+
+// redisStreamBlock bounds how long a single XReadGroup call waits for
+// new entries before returning empty, so Next can still observe ctx
+// cancellation between polls.
+const redisStreamBlock = 200 * time.Millisecond
+
+// redisStreamBatchSize caps how many stream entries Next pulls per call,
+// mirroring the batch size the root tree's XReadGroup loop already uses.
+const redisStreamBatchSize = 200
+
+// redisStreamSource pulls payment messages off a Redis Streams consumer
+// group, acking consumed entries only once the caller's AckFn runs
+// rather than immediately on read, so a crash between Next and AckFn
+// leaves the entries pending for XClaim/XAutoClaim to reclaim.
+type redisStreamSource struct {
+	client   *redis.Client
+	stream   string
+	group    string
+	consumer string
+	logger   *slog.Logger
+}
+
+func newRedisStreamSource(cfg Config, logger *slog.Logger) (*redisStreamSource, error) {
+	opt, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opt)
+	if err := client.XGroupCreateMkStream(context.Background(), cfg.RedisStreamName, cfg.RedisStreamGroup, "0").Err(); err != nil && !errors.Is(err, redis.Nil) {
+		logger.Debug("Consumer group already exists", "stream", cfg.RedisStreamName, "group", cfg.RedisStreamGroup, "err", err)
+	}
+
+	return &redisStreamSource{
+		client:   client,
+		stream:   cfg.RedisStreamName,
+		group:    cfg.RedisStreamGroup,
+		consumer: cfg.RedisConsumerName,
+		logger:   logger,
+	}, nil
+}
+
+func (s *redisStreamSource) Next(ctx context.Context) ([]payments.PaymentMessage, AckFn, error) {
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.group,
+		Consumer: s.consumer,
+		Streams:  []string{s.stream, ">"},
+		Block:    redisStreamBlock,
+		Count:    redisStreamBatchSize,
+	}).Result()
+
+	if errors.Is(err, redis.Nil) || (err == nil && len(streams) == 0) {
+		return nil, noopAck, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := streams[0].Messages
+	msgs := make([]payments.PaymentMessage, 0, len(entries))
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		raw, ok := entry.Values["data"].(string)
+		if !ok {
+			s.logger.Warn("Stream entry missing data field", "id", entry.ID)
+			ids = append(ids, entry.ID)
+			continue
+		}
+
+		var msg payments.PaymentMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			s.logger.Warn("Failed to decode stream entry", "id", entry.ID, "err", err)
+			ids = append(ids, entry.ID)
+			continue
+		}
+
+		msgs = append(msgs, msg)
+		ids = append(ids, entry.ID)
+	}
+
+	ack := func(ctx context.Context) error {
+		if len(ids) == 0 {
+			return nil
+		}
+		return s.client.XAck(ctx, s.stream, s.group, ids...).Err()
+	}
+
+	return msgs, ack, nil
+}
+
+func (s *redisStreamSource) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,67 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"rinha/internal/payments"
+)
+
+// AckFn acknowledges a batch of messages previously returned by a
+// Source's Next, so a crash between Next and AckFn redelivers them
+// instead of losing them. Sources for which redelivery is meaningless
+// (UDS has no backlog to replay from) return a no-op AckFn.
+type AckFn func(ctx context.Context) error
+
+// Source abstracts where the worker pulls batches of payment messages
+// from, so the ingestion loop in cmd/worker can run over a Unix domain
+// socket or Redis Streams without knowing which. A NATS JetStream driver
+// was scoped for higher-throughput multi-host deployments but isn't
+// implemented, so "nats" isn't an accepted Driver value below rather
+// than left selectable as a dead path.
+type Source interface {
+	// Next waits (subject to ctx) for messages, returning the batch
+	// along with the AckFn the caller must invoke once every message in
+	// it has been durably handed off (e.g. enqueued on WorkerPool). The
+	// batch can be empty: the Redis Streams source returns one with a
+	// no-op AckFn when nothing arrived within redisStreamBlock.
+	Next(ctx context.Context) ([]payments.PaymentMessage, AckFn, error)
+	Close() error
+}
+
+// Sink abstracts where the API process hands payment submissions off
+// to, mirroring Source on the producer side.
+type Sink interface {
+	// Submit hands raw to the sink for delivery to a Source on the
+	// other side. It returns ErrBackpressure if the sink's receiver
+	// signalled it's overloaded.
+	Submit(ctx context.Context, raw []byte) error
+	Close() error
+}
+
+// NewSource builds the Source selected by cfg.Driver, defaulting to the
+// Unix domain socket driver when unset.
+func NewSource(cfg Config, logger *slog.Logger) (Source, error) {
+	switch cfg.Driver {
+	case "", DriverUnix:
+		return newUnixSource(cfg, logger)
+	case DriverRedis:
+		return newRedisStreamSource(cfg, logger)
+	default:
+		return nil, fmt.Errorf("messages: unknown driver %q", cfg.Driver)
+	}
+}
+
+// NewSink builds the Sink selected by cfg.Driver, defaulting to the Unix
+// domain socket driver when unset.
+func NewSink(cfg Config, logger *slog.Logger) (Sink, error) {
+	switch cfg.Driver {
+	case "", DriverUnix:
+		return newUnixSink(cfg, logger)
+	case DriverRedis:
+		return newRedisStreamSink(cfg, logger)
+	default:
+		return nil, fmt.Errorf("messages: unknown driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,33 @@
+package messages
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"rinha/internal/payments"
+	"rinha/internal/payments/workers"
+)
+
+// NewSubmitHandler builds the Transport.Subscribe callback used by the
+// worker process: it decodes each raw message into a PaymentMessage and
+// hands it to pool, returning whether pool accepted it so transports that
+// support it can NACK the sender. A message rejected for being
+// overloaded is reported as not accepted; one that fails to parse is
+// logged and dropped but still acked, since redelivery wouldn't help.
+func NewSubmitHandler(pool *workers.WorkerPool, logger *slog.Logger) func([]byte) bool {
+	return func(raw []byte) bool {
+		if pool.Overloaded() {
+			logger.Warn("Queue occupancy above high-water mark, NACKing")
+			return false
+		}
+
+		var msg payments.PaymentMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			logger.Warn("Failed to decode payment message", "err", err)
+			return true
+		}
+
+		logger.Info("Received message", "msg", msg)
+		return pool.Submit(&msg)
+	}
+}
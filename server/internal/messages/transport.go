@@ -0,0 +1,87 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrBackpressure is returned by PublishContext when the receiver NACKed
+// the message because its queue occupancy was above its high-water mark.
+// Callers that can shed load (an HTTP handler, say) should surface this
+// distinctly from a transport-level failure rather than retry blindly.
+var ErrBackpressure = errors.New("messages: receiver signalled backpressure")
+
+// Transport abstracts the channel used to hand payment messages from the
+// API process to the worker process, so the two can be deployed across
+// hosts (or kept on one, sharing a filesystem) without the callers on
+// either side knowing which wire format is underneath.
+type Transport interface {
+	// Publish hands msg to the transport for delivery to subscribers.
+	Publish(msg []byte) error
+	// PublishContext is like Publish but aborts the enqueue/write and
+	// releases the underlying connection once ctx is done, instead of
+	// blocking on it indefinitely. It returns ErrBackpressure if the
+	// receiver NACKed the message.
+	PublishContext(ctx context.Context, msg []byte) error
+	// Subscribe invokes handler for every message received, passing its
+	// return value back to the transport so it can push back on the
+	// sender (ACK/NACK) when the wire format supports it. It blocks
+	// until the transport is closed.
+	Subscribe(handler func([]byte) bool) error
+	Close() error
+}
+
+// AckPublisher is implemented by transports that can confirm a receiver
+// committed a specific message before returning, identified by seq.
+// OutboxPublisher uses it to know exactly when it's safe to discard a
+// staged entry; transports that don't implement it are treated as
+// fire-and-forget.
+type AckPublisher interface {
+	// PublishAck sends msg tagged with seq and blocks until the
+	// receiver's ack for that seq arrives or ctx is done. acked is
+	// false with a nil error when the receiver NACKed the message; a
+	// send or ack wait that didn't complete (ctx done, connection
+	// failed) returns false with a non-nil error.
+	PublishAck(ctx context.Context, seq uint64, msg []byte) (acked bool, err error)
+}
+
+// Driver names a Transport implementation, selected via config.AppConfig.
+type Driver string
+
+const (
+	DriverUnix  Driver = "unix"
+	DriverRedis Driver = "redis"
+)
+
+// Config selects and configures a Transport implementation.
+type Config struct {
+	Driver Driver
+
+	UnixSocketPath string
+	UnixMaxConns   int
+
+	RedisURL     string
+	RedisChannel string
+
+	// RedisStreamName/RedisStreamGroup/RedisConsumerName configure the
+	// Redis Streams Source/Sink (consumer-group ack/claim semantics),
+	// as opposed to RedisChannel which backs the Pub/Sub Transport.
+	RedisStreamName   string
+	RedisStreamGroup  string
+	RedisConsumerName string
+}
+
+// New builds the Transport selected by cfg.Driver, defaulting to the
+// Unix domain socket driver when unset.
+func New(cfg Config, logger *slog.Logger) (Transport, error) {
+	switch cfg.Driver {
+	case "", DriverUnix:
+		return NewUnixTransport(cfg.UnixSocketPath, cfg.UnixMaxConns, logger)
+	case DriverRedis:
+		return NewRedisTransport(cfg.RedisURL, cfg.RedisChannel, logger)
+	default:
+		return nil, fmt.Errorf("messages: unknown driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,29 @@
+package messages
+
+import (
+	"context"
+	"log/slog"
+)
+
+// unixSink wraps UnixTransport on the producer side, so a Sink user gets
+// the same framed ACK/NACK semantics as Transport without depending on
+// the wider Transport interface.
+type unixSink struct {
+	transport *UnixTransport
+}
+
+func newUnixSink(cfg Config, logger *slog.Logger) (*unixSink, error) {
+	transport, err := NewUnixTransport(cfg.UnixSocketPath, cfg.UnixMaxConns, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &unixSink{transport: transport}, nil
+}
+
+func (s *unixSink) Submit(ctx context.Context, raw []byte) error {
+	return s.transport.PublishContext(ctx, raw)
+}
+
+func (s *unixSink) Close() error {
+	return s.transport.Close()
+}
@@ -0,0 +1,79 @@
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"rinha/internal/payments"
+)
+
+// unixSource adapts UnixTransport's push-based Subscribe to Source's
+// pull-based Next by buffering decoded messages on a channel fed from a
+// background Subscribe goroutine. Each frame's ACK/NACK is already
+// resolved synchronously inside the feeding handler (UnixTransport has
+// no backlog to replay from), so the returned AckFn is a no-op.
+type unixSource struct {
+	transport *UnixTransport
+	logger    *slog.Logger
+	msgs      chan payments.PaymentMessage
+	errs      chan error
+}
+
+func newUnixSource(cfg Config, logger *slog.Logger) (*unixSource, error) {
+	transport, err := NewUnixTransport(cfg.UnixSocketPath, cfg.UnixMaxConns, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &unixSource{
+		transport: transport,
+		logger:    logger,
+		msgs:      make(chan payments.PaymentMessage, queueCapacityHint),
+		errs:      make(chan error, 1),
+	}
+
+	go func() {
+		err := transport.Subscribe(func(raw []byte) bool {
+			var msg payments.PaymentMessage
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				logger.Warn("Failed to decode payment message", "err", err)
+				return true
+			}
+
+			select {
+			case s.msgs <- msg:
+				return true
+			default:
+				return false
+			}
+		})
+		if err != nil {
+			s.errs <- err
+		}
+	}()
+
+	return s, nil
+}
+
+// queueCapacityHint sizes the adapter channel between the Subscribe
+// handler and Next. It is far smaller than WorkerPool's own submit queue
+// (queueCapacity, 32768); once it is full the handler NACKs new frames.
+const queueCapacityHint = 1024
+
+func (s *unixSource) Next(ctx context.Context) ([]payments.PaymentMessage, AckFn, error) {
+	select {
+	case msg := <-s.msgs:
+		return []payments.PaymentMessage{msg}, noopAck, nil
+	case err := <-s.errs:
+		return nil, nil, err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (s *unixSource) Close() error {
+	return s.transport.Close()
+}
+
+func noopAck(ctx context.Context) error { return nil }
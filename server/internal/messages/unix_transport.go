@@ -0,0 +1,295 @@
+package messages
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// UnixTransport is the Transport implementation used when the API and
+// worker processes share a filesystem: it frames each message with a
+// 4-byte length prefix over a Unix domain socket and waits for a 1-byte
+// ACK/NACK reply per frame, pooling connections on the publish side.
+type UnixTransport struct {
+	socketPath string
+	maxConns   int
+	conns      chan net.Conn
+	dialer     *net.Dialer
+	logger     *slog.Logger
+
+	ln     net.Listener
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewUnixTransport dials an initial connection to socketPath so Publish
+// has a warm connection ready, pooling up to maxConns of them.
+func NewUnixTransport(socketPath string, maxConns int, logger *slog.Logger) (*UnixTransport, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &UnixTransport{
+		socketPath: socketPath,
+		maxConns:   maxConns,
+		conns:      make(chan net.Conn, maxConns),
+		dialer: &net.Dialer{
+			Timeout:   100 * time.Millisecond,
+			KeepAlive: 30 * time.Second,
+		},
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	c, err := t.dialer.Dial("unix", socketPath)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	t.conns <- c
+	return t, nil
+}
+
+const (
+	ackByte  = 0x01
+	nackByte = 0x00
+)
+
+var bwPool = sync.Pool{
+	New: func() any { return bufio.NewWriterSize(nil, 512) },
+}
+
+func (t *UnixTransport) Publish(msg []byte) error {
+	return t.PublishContext(context.Background(), msg)
+}
+
+// PublishContext is like Publish but honors ctx.Done(): a cancelCh is
+// closed the moment the deadline fires, and the write is aborted and the
+// connection dropped rather than left to drain into a closed socket.
+// seq 0 marks a fire-and-forget publish as far as the outbox is
+// concerned, but the receiver still replies ACK/NACK so PublishContext
+// can surface ErrBackpressure when the worker is overloaded.
+func (t *UnixTransport) PublishContext(ctx context.Context, msg []byte) error {
+	acked, err := t.publishFrame(ctx, 0, msg)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrBackpressure
+	}
+	return nil
+}
+
+// PublishAck sends msg tagged with seq over the pooled connection and
+// blocks until the receiver's ACK/NACK reply arrives, confirming the
+// handler accepted it before the caller's outbox entry is discarded.
+// acked is false with a nil error when the receiver NACKed (overloaded);
+// a failed dial, a connection torn down mid-exchange or ctx done first
+// returns a non-nil error instead.
+func (t *UnixTransport) PublishAck(ctx context.Context, seq uint64, msg []byte) (bool, error) {
+	return t.publishFrame(ctx, seq, msg)
+}
+
+func (t *UnixTransport) publishFrame(ctx context.Context, seq uint64, msg []byte) (bool, error) {
+	conn, err := t.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	cancelCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(cancelCh)
+			_ = conn.Close()
+		case <-doneCh:
+		}
+	}()
+
+	bw := bwPool.Get().(*bufio.Writer)
+	bw.Reset(conn)
+	_, err = bw.Write(encodeFrame(seq, msg))
+	if err == nil {
+		err = bw.Flush()
+	}
+	bwPool.Put(bw)
+
+	var acked bool
+	if err == nil {
+		var reply [1]byte
+		_, err = io.ReadFull(conn, reply[:])
+		acked = reply[0] == ackByte
+	}
+
+	close(doneCh)
+
+	if err != nil {
+		select {
+		case <-cancelCh:
+			return false, ctx.Err()
+		default:
+		}
+		_ = conn.Close()
+		t.replace()
+		return false, err
+	}
+
+	t.release(conn)
+	return acked, nil
+}
+
+// encodeFrame prefixes msg with a 4-byte big-endian length (covering the
+// seq and payload that follow) and the outbox sequence number, so the
+// receiver can read an exact frame off the stream without delimiter
+// scanning and echo back whether it admitted it.
+func encodeFrame(seq uint64, msg []byte) []byte {
+	body := make([]byte, 8+len(msg))
+	binary.BigEndian.PutUint64(body[:8], seq)
+	copy(body[8:], msg)
+
+	buf := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(body)))
+	copy(buf[4:], body)
+	return buf
+}
+
+// readFrame reads one frame written by encodeFrame off r.
+func readFrame(r io.Reader) (seq uint64, payload []byte, err error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return 0, nil, err
+	}
+
+	body := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return binary.BigEndian.Uint64(body[:8]), body[8:], nil
+}
+
+func (t *UnixTransport) acquire(ctx context.Context) (net.Conn, error) {
+	select {
+	case c := <-t.conns:
+		return c, nil
+	default:
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	resultCh := make(chan dialResult, 1)
+	go func() {
+		c, err := t.dialer.DialContext(ctx, "unix", t.socketPath)
+		resultCh <- dialResult{c, err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.conn, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *UnixTransport) release(conn net.Conn) {
+	select {
+	case t.conns <- conn:
+	default:
+		_ = conn.Close()
+	}
+}
+
+func (t *UnixTransport) replace() {
+	c, err := t.dialer.Dial("unix", t.socketPath)
+	if err != nil {
+		return
+	}
+	t.release(c)
+}
+
+// Subscribe listens on socketPath and invokes handler for every
+// length-prefixed frame received, until Close is called.
+func (t *UnixTransport) Subscribe(handler func([]byte) bool) error {
+	_ = os.Remove(t.socketPath)
+
+	ln, err := net.Listen("unix", t.socketPath)
+	if err != nil {
+		return err
+	}
+	t.ln = ln
+
+	t.wg.Add(1)
+	t.acceptLoop(handler)
+	return nil
+}
+
+func (t *UnixTransport) acceptLoop(handler func([]byte) bool) {
+	defer t.wg.Done()
+
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			select {
+			case <-t.ctx.Done():
+				return
+			default:
+				t.logger.Error("Failed to accept connection", "err", err)
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+		}
+
+		t.logger.Info("Accepted UDS connection", "remoteAddr", conn.RemoteAddr())
+		t.wg.Add(1)
+		go t.readProducer(conn, handler)
+	}
+}
+
+func (t *UnixTransport) readProducer(conn net.Conn, handler func([]byte) bool) {
+	defer t.wg.Done()
+	defer conn.Close()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		default:
+		}
+
+		_, payload, err := readFrame(conn)
+		if err != nil {
+			if err != io.EOF {
+				t.logger.Warn("Failed to read frame", "err", err)
+			}
+			return
+		}
+
+		accepted := handler(payload)
+
+		reply := byte(nackByte)
+		if accepted {
+			reply = ackByte
+		}
+		if _, err := conn.Write([]byte{reply}); err != nil {
+			t.logger.Warn("Failed to write ack/nack reply", "err", err)
+			return
+		}
+	}
+}
+
+func (t *UnixTransport) Close() error {
+	t.cancel()
+	if t.ln != nil {
+		_ = t.ln.Close()
+	}
+	t.wg.Wait()
+	return nil
+}
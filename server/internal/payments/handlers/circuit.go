@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"rinha/internal/payments/workers"
+)
+
+type CircuitHandler struct {
+	healthMonitor *workers.ProcessorHealthMonitor
+}
+
+func NewCircuitHandler(healthMonitor *workers.ProcessorHealthMonitor) *CircuitHandler {
+	return &CircuitHandler{healthMonitor: healthMonitor}
+}
+
+// ServeHTTP handles GET /health/circuit, reporting each processor's
+// current circuit breaker state.
+func (h *CircuitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.healthMonitor.BreakerSnapshot())
+}
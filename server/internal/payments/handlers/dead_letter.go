@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"rinha/server/internal/payments/workers"
+	"strconv"
+)
+
+const defaultDeadLetterReplayLimit = 100
+
+type DeadLetterHandler struct {
+	pool *workers.WorkerPool
+}
+
+func NewDeadLetterHandler(pool *workers.WorkerPool) *DeadLetterHandler {
+	return &DeadLetterHandler{pool: pool}
+}
+
+// ServeHTTP handles POST /dead-letter/replay?limit=N, requeuing up to
+// limit dead-lettered payments back onto the worker pool.
+func (h *DeadLetterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultDeadLetterReplayLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	requeued, err := h.pool.Replay(r.Context(), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"requeued": requeued})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rinha/server/internal/payments/workers"
+)
+
+type MetricsHandler struct {
+	pool *workers.WorkerPool
+}
+
+func NewMetricsHandler(pool *workers.WorkerPool) *MetricsHandler {
+	return &MetricsHandler{pool: pool}
+}
+
+// ServeHTTP handles GET /metrics, exposing queue depth, submit-drop count
+// and per-processor success/failure counters in Prometheus text exposition
+// format so a scrape target can chart backpressure taking effect.
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	m := h.pool.Metrics()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP rinha_queue_depth Payments currently buffered in the submit queue.")
+	fmt.Fprintln(w, "# TYPE rinha_queue_depth gauge")
+	fmt.Fprintf(w, "rinha_queue_depth %d\n", m.QueueDepth)
+
+	fmt.Fprintln(w, "# HELP rinha_retry_queue_depth Payments currently waiting on the retry heap.")
+	fmt.Fprintln(w, "# TYPE rinha_retry_queue_depth gauge")
+	fmt.Fprintf(w, "rinha_retry_queue_depth %d\n", m.RetryQueueDepth)
+
+	fmt.Fprintln(w, "# HELP rinha_submit_drops_total Payments dropped because the submit queue was full.")
+	fmt.Fprintln(w, "# TYPE rinha_submit_drops_total counter")
+	fmt.Fprintf(w, "rinha_submit_drops_total %d\n", m.SubmitDrops)
+
+	fmt.Fprintln(w, "# HELP rinha_processor_requests_total Payments settled per processor and outcome.")
+	fmt.Fprintln(w, "# TYPE rinha_processor_requests_total counter")
+	fmt.Fprintf(w, "rinha_processor_requests_total{processor=\"default\",outcome=\"success\"} %d\n", m.DefaultSuccesses)
+	fmt.Fprintf(w, "rinha_processor_requests_total{processor=\"default\",outcome=\"failure\"} %d\n", m.DefaultFailures)
+	fmt.Fprintf(w, "rinha_processor_requests_total{processor=\"fallback\",outcome=\"success\"} %d\n", m.FallbackSuccesses)
+	fmt.Fprintf(w, "rinha_processor_requests_total{processor=\"fallback\",outcome=\"failure\"} %d\n", m.FallbackFailures)
+}
@@ -1,17 +1,29 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"rinha/internal/messages"
+	"time"
+)
+
+const (
+	// publishRetries bounds how many publish attempts, in all, ServeHTTP
+	// makes while each is NACKed for backpressure before giving up and
+	// responding 503, instead of accepting the request and silently
+	// losing it.
+	publishRetries = 3
+	publishBackoff = 10 * time.Millisecond
 )
 
 type PaymentHandler struct {
-	publisher *messages.Publisher
+	transport messages.Transport
 }
 
-func NewPaymentHandler(publisher *messages.Publisher) *PaymentHandler {
-	return &PaymentHandler{publisher: publisher}
+func NewPaymentHandler(transport messages.Transport) *PaymentHandler {
+	return &PaymentHandler{transport: transport}
 }
 
 func (h *PaymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -23,10 +35,34 @@ func (h *PaymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	_ = r.Body.Close()
 
-	if err := h.publisher.Publish(raw); err != nil {
+	if err := h.publishWithRetry(r.Context(), raw); err != nil {
+		if errors.Is(err, messages.ErrBackpressure) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// publishWithRetry retries a publish NACKed for backpressure a bounded
+// number of times, giving the worker a little room to drain before the
+// caller gives up and the handler responds 503.
+func (h *PaymentHandler) publishWithRetry(ctx context.Context, raw []byte) error {
+	var err error
+	for attempt := 0; attempt < publishRetries; attempt++ {
+		err = h.transport.PublishContext(ctx, raw)
+		if !errors.Is(err, messages.ErrBackpressure) {
+			return err
+		}
+
+		select {
+		case <-time.After(publishBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
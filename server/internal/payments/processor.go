@@ -22,6 +22,10 @@ const (
 var (
 	ErrUnavailableProcessor = errors.New("unavailable processor")
 	ErrInvalidPayment       = errors.New("invalid payment")
+	// ErrDuplicate is returned when the upstream processor reports it
+	// already settled this CorrelationId, so the worker can record the
+	// payment as a success instead of retrying it.
+	ErrDuplicate = errors.New("duplicate payment")
 )
 
 type PaymentProcessor struct {
@@ -79,6 +83,10 @@ func (s *PaymentProcessor) Process(ctx context.Context, msg *PaymentMessage) err
 		return ErrInvalidPayment
 	}
 
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		return ErrDuplicate
+	}
+
 	if resp != nil && (resp.StatusCode >= 500 || resp.StatusCode == 429 || resp.StatusCode == 408) {
 		return ErrUnavailableProcessor
 	}
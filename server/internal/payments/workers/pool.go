@@ -4,10 +4,14 @@ import (
 	"container/heap"
 	"context"
 	"errors"
+	"github.com/redis/go-redis/v9"
 	"log/slog"
 	"math/rand"
 	"rinha/internal/payments"
+	healthmonitor "rinha/internal/payments/workers"
+	"rinha/internal/webhooks"
 	"runtime"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +22,22 @@ const (
 	baseBackoff    = 500 * time.Millisecond
 	maxBackoff     = 5 * time.Second
 	jitterFraction = 0.20 // 20 %
+
+	// dlqHydrateLimit bounds how many due dead letters Start resubmits to
+	// the queue (via Submit) in one pass so a large backlog doesn't block
+	// startup.
+	dlqHydrateLimit = 1000
+
+	// dedupTTL is how long a CorrelationId's claim is kept in Redis to
+	// short-circuit processor calls for duplicated messages; retry releases
+	// the claim so a requeued or dead-lettered message is processed again.
+	dedupTTL = 24 * time.Hour
+
+	// highWaterFraction is the occupancy fraction of queue/retryQueue
+	// above which Overloaded reports true, so the receiver starts
+	// NACKing before the channels are actually full and would drop
+	// silently.
+	highWaterFraction = 0.9
 )
 
 var numWorkers = runtime.GOMAXPROCS(0) * 8
@@ -50,10 +70,18 @@ type WorkerPool struct {
 	fallbackProcessor *payments.PaymentProcessor
 	store             *payments.PaymentStore
 	logger            *slog.Logger
-	healthMonitor     *ProcessorHealthMonitor
+	healthMonitor     *healthmonitor.ProcessorHealthMonitor
+	webhooks          *webhooks.Dispatcher
+	redisClient       *redis.Client
+
+	submitDrops       atomic.Int64
+	defaultSuccesses  atomic.Int64
+	defaultFailures   atomic.Int64
+	fallbackSuccesses atomic.Int64
+	fallbackFailures  atomic.Int64
 }
 
-func NewWorkerPool(def, fallbackProcessor *payments.PaymentProcessor, store *payments.PaymentStore, logger *slog.Logger, healthMonitor *ProcessorHealthMonitor) *WorkerPool {
+func NewWorkerPool(def, fallbackProcessor *payments.PaymentProcessor, store *payments.PaymentStore, logger *slog.Logger, healthMonitor *healthmonitor.ProcessorHealthMonitor, dispatcher *webhooks.Dispatcher, redisClient *redis.Client) *WorkerPool {
 	return &WorkerPool{
 		rng:               rand.New(rand.NewSource(time.Now().UnixNano())),
 		queue:             make(chan *payments.PaymentMessage, queueCapacity),
@@ -63,6 +91,8 @@ func NewWorkerPool(def, fallbackProcessor *payments.PaymentProcessor, store *pay
 		store:             store,
 		logger:            logger,
 		healthMonitor:     healthMonitor,
+		webhooks:          dispatcher,
+		redisClient:       redisClient,
 	}
 }
 
@@ -71,6 +101,7 @@ func (p *WorkerPool) Start() {
 		go p.run()
 	}
 	go p.retryLoop()
+	p.hydrateFromDeadLetter(context.Background())
 }
 
 func (p *WorkerPool) Stop() {
@@ -79,15 +110,58 @@ func (p *WorkerPool) Stop() {
 }
 
 func (p *WorkerPool) Submit(msg *payments.PaymentMessage) bool {
+	return p.SubmitContext(context.Background(), msg)
+}
+
+// SubmitContext is like Submit but never waits for room in the queue: a
+// full queue drops msg at once and counts it in submitDrops, unless ctx is
+// already done, in which case msg is rejected without counting a drop.
+func (p *WorkerPool) SubmitContext(ctx context.Context, msg *payments.PaymentMessage) bool {
 	select {
 	case p.queue <- msg:
 		return true
+	case <-ctx.Done():
+		p.logger.Warn("Submit aborted, context done", "correlationId", msg.CorrelationId)
+		return false
 	default:
 		p.logger.Warn("Submit queue is full, dropping message")
+		p.submitDrops.Add(1)
 		return false
 	}
 }
 
+// Overloaded reports whether queue or retryQueue occupancy is above
+// highWaterFraction, so a transport that supports NACKing (unix) can shed
+// load ahead of Submit's own full-channel drop.
+func (p *WorkerPool) Overloaded() bool {
+	return len(p.queue) > int(float64(queueCapacity)*highWaterFraction) ||
+		len(p.retryQueue) > int(float64(retryCapacity)*highWaterFraction)
+}
+
+// PoolMetrics is a point-in-time snapshot of WorkerPool's counters, used
+// by the admin /metrics endpoint.
+type PoolMetrics struct {
+	QueueDepth        int
+	RetryQueueDepth   int
+	SubmitDrops       int64
+	DefaultSuccesses  int64
+	DefaultFailures   int64
+	FallbackSuccesses int64
+	FallbackFailures  int64
+}
+
+func (p *WorkerPool) Metrics() PoolMetrics {
+	return PoolMetrics{
+		QueueDepth:        len(p.queue),
+		RetryQueueDepth:   len(p.retryQueue),
+		SubmitDrops:       p.submitDrops.Load(),
+		DefaultSuccesses:  p.defaultSuccesses.Load(),
+		DefaultFailures:   p.defaultFailures.Load(),
+		FallbackSuccesses: p.fallbackSuccesses.Load(),
+		FallbackFailures:  p.fallbackFailures.Load(),
+	}
+}
+
 func (p *WorkerPool) run() {
 	ctx := context.Background()
 	for msg := range p.queue {
@@ -95,11 +169,20 @@ func (p *WorkerPool) run() {
 	}
 }
 
+// process consults the processor circuit breakers via DetermineProcessor
+// before ever issuing an HTTP request: a processor whose breaker is open
+// is never returned, so a degraded default processor sheds load onto the
+// fallback (or retry) instead of being hit on every call.
 func (p *WorkerPool) process(ctx context.Context, msg *payments.PaymentMessage) {
+	if p.seenBefore(ctx, msg.CorrelationId) {
+		p.logger.Debug("Skipping already-seen payment", "correlationId", msg.CorrelationId)
+		return
+	}
+
 	m := msg
 	processorType, err := p.healthMonitor.DetermineProcessor()
 
-	if err != nil && errors.Is(err, ErrBothProcessorsUnavailable) {
+	if err != nil && errors.Is(err, healthmonitor.ErrBothProcessorsUnavailable) {
 		p.retry(m)
 	}
 
@@ -113,31 +196,66 @@ func (p *WorkerPool) process(ctx context.Context, msg *payments.PaymentMessage)
 }
 
 func (p *WorkerPool) processDefault(ctx context.Context, msg *payments.PaymentMessage) {
+	start := time.Now()
 	err := p.defaultProcessor.Process(ctx, msg)
 	if err != nil && errors.Is(err, payments.ErrUnavailableProcessor) {
 		p.logger.Debug("Default processor unavailable")
+		p.healthMonitor.InformFailure(payments.ProcessorTypeDefault)
+		p.defaultFailures.Add(1)
 		p.retry(msg)
 		return
 	}
+	if err != nil && errors.Is(err, payments.ErrDuplicate) {
+		p.logger.Debug("Default processor reported duplicate, recording as success", "correlationId", msg.CorrelationId)
+	}
 
+	p.defaultSuccesses.Add(1)
+	p.healthMonitor.InformSuccess(payments.ProcessorTypeDefault, time.Since(start).Milliseconds())
 	p.store.Add(payments.NewPayment(msg.Amount, msg.CorrelationId, payments.ProcessorTypeDefault, msg.RequestedAt))
+	p.webhooks.Emit(ctx, webhooks.Event{
+		Type: webhooks.EventPaymentSucceeded,
+		Data: map[string]any{"correlationId": msg.CorrelationId, "processor": payments.ProcessorTypeDefault},
+	})
 }
 
 func (p *WorkerPool) processFallback(ctx context.Context, msg *payments.PaymentMessage) {
+	start := time.Now()
 	err := p.fallbackProcessor.Process(ctx, msg)
 	if err != nil && errors.Is(err, payments.ErrUnavailableProcessor) {
 		p.logger.Debug("Fallback processor unavailable")
+		p.healthMonitor.InformFailure(payments.ProcessorTypeFallback)
+		p.fallbackFailures.Add(1)
 		p.retry(msg)
 		return
 	}
+	if err != nil && errors.Is(err, payments.ErrDuplicate) {
+		p.logger.Debug("Fallback processor reported duplicate, recording as success", "correlationId", msg.CorrelationId)
+	}
 
+	p.fallbackSuccesses.Add(1)
+	p.healthMonitor.InformSuccess(payments.ProcessorTypeFallback, time.Since(start).Milliseconds())
 	p.store.Add(payments.NewPayment(msg.Amount, msg.CorrelationId, payments.ProcessorTypeFallback, msg.RequestedAt))
+	p.webhooks.Emit(ctx, webhooks.Event{
+		Type: webhooks.EventPaymentSucceeded,
+		Data: map[string]any{"correlationId": msg.CorrelationId, "processor": payments.ProcessorTypeFallback},
+	})
 }
 
 func (p *WorkerPool) retry(msg *payments.PaymentMessage) {
+	// The claim seenBefore took for this attempt is released, so the
+	// requeued message (or a later dead-letter replay) isn't skipped as
+	// already seen.
+	if p.redisClient != nil {
+		_ = p.redisClient.Del(context.Background(), "payments:dedup:"+msg.CorrelationId).Err()
+	}
+
 	if msg.RetryCount >= maxRetries {
-		// Drop the message
-		p.logger.Warn("Max retries exceeded, dropping message", "correlationId", msg.CorrelationId)
+		p.logger.Warn("Max retries exceeded, moving to dead-letter queue", "correlationId", msg.CorrelationId)
+		p.deadLetter(msg, "max retries exceeded")
+		p.webhooks.Emit(context.Background(), webhooks.Event{
+			Type: webhooks.EventPaymentFailed,
+			Data: map[string]any{"correlationId": msg.CorrelationId, "retryCount": msg.RetryCount},
+		})
 		return
 	}
 
@@ -153,8 +271,105 @@ func (p *WorkerPool) retry(msg *payments.PaymentMessage) {
 	select {
 	case p.retryQueue <- item:
 	default:
-		p.logger.Warn("Retry queue is full, dropping message", "correlationId", msg.CorrelationId)
+		p.logger.Warn("Retry queue is full, moving to dead-letter queue", "correlationId", msg.CorrelationId)
+		p.deadLetter(msg, "retry queue full")
+	}
+}
+
+// seenBefore is a fast Redis-backed pre-check that skips processor calls
+// for a CorrelationId whose claim an earlier delivery still holds (retry
+// releases it), ahead of the
+// Postgres-level ON CONFLICT DO NOTHING that's the final source of
+// truth. A Redis error fails open (treated as not-seen) so a dedup outage
+// degrades to relying on the database constraint rather than dropping
+// payments.
+func (p *WorkerPool) seenBefore(ctx context.Context, correlationId string) bool {
+	if p.redisClient == nil {
+		return false
 	}
+
+	claimed, err := p.redisClient.SetNX(ctx, "payments:dedup:"+correlationId, 1, dedupTTL).Result()
+	if err != nil {
+		p.logger.Warn("Dedup check failed, proceeding without it", "correlationId", correlationId, "err", err)
+		return false
+	}
+	return !claimed
+}
+
+// deadLetter persists msg to payments_dead_letter instead of dropping it
+// silently, so it survives the process and can be replayed once the
+// processors recover.
+func (p *WorkerPool) deadLetter(msg *payments.PaymentMessage, reason string) {
+	err := p.store.AddDeadLetter(context.Background(), payments.DeadLetter{
+		CorrelationId: msg.CorrelationId,
+		Amount:        msg.Amount,
+		RequestedAt:   msg.RequestedAt,
+		RetryCount:    msg.RetryCount,
+		LastError:     reason,
+		NextAttempt:   time.Now().Add(baseBackoff),
+	})
+	if err != nil {
+		p.logger.Error("Failed to persist dead letter", "correlationId", msg.CorrelationId, "err", err)
+	}
+}
+
+// hydrateFromDeadLetter scans the DLQ for entries whose next_attempt has
+// already passed and resubmits them, so a long processor outage doesn't
+// lose payments across a worker restart.
+func (p *WorkerPool) hydrateFromDeadLetter(ctx context.Context) {
+	items, err := p.store.DueDeadLetters(ctx, dlqHydrateLimit)
+	if err != nil {
+		p.logger.Error("Failed to scan dead-letter queue on startup", "err", err)
+		return
+	}
+
+	for _, dl := range items {
+		msg := &payments.PaymentMessage{
+			Amount:        dl.Amount,
+			CorrelationId: dl.CorrelationId,
+			RequestedAt:   dl.RequestedAt,
+			RetryCount:    dl.RetryCount,
+		}
+		if p.Submit(msg) {
+			if err := p.store.DeleteDeadLetter(ctx, dl.ID); err != nil {
+				p.logger.Error("Failed to delete hydrated dead-letter row", "id", dl.ID, "err", err)
+			}
+		}
+	}
+
+	if len(items) > 0 {
+		p.logger.Info("Resubmitted due dead letters to the queue", "count", len(items))
+	}
+}
+
+// Replay requeues up to limit dead-letter rows, regardless of
+// next_attempt, back onto the queue. It backs the admin
+// POST /dead-letter/replay?limit=N endpoint.
+func (p *WorkerPool) Replay(ctx context.Context, limit int) (int, error) {
+	items, err := p.store.ListDeadLetters(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, dl := range items {
+		msg := &payments.PaymentMessage{
+			Amount:        dl.Amount,
+			CorrelationId: dl.CorrelationId,
+			RequestedAt:   dl.RequestedAt,
+			RetryCount:    dl.RetryCount,
+		}
+		if !p.Submit(msg) {
+			continue
+		}
+		if err := p.store.DeleteDeadLetter(ctx, dl.ID); err != nil {
+			p.logger.Error("Failed to delete replayed dead-letter row", "id", dl.ID, "err", err)
+			continue
+		}
+		requeued++
+	}
+
+	return requeued, nil
 }
 
 func (p *WorkerPool) retryLoop() {